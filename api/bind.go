@@ -0,0 +1,285 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrBodyTooLarge is returned when reading a body past the route's limit.
+var ErrBodyTooLarge = &Error{
+	Code:   ErrorCodeBodyTooLarge,
+	Status: http.StatusRequestEntityTooLarge,
+	Detail: "request body too large",
+}
+
+// StrictDecoding reports whether BindJSON rejects fields the target struct
+// does not declare. It is pointed at the strict_json_decoding feature flag
+// at startup.
+var StrictDecoding = func(ctx context.Context) bool {
+	return true
+}
+
+var registerTagNameOnce sync.Once
+
+// BindJSON decodes the body into dst and validates its `binding` tags,
+// answering any failure with the shared error envelope. It reports false
+// after aborting the request if the body is unusable.
+func BindJSON(c *gin.Context, dst interface{}) bool {
+	registerTagNameOnce.Do(func() {
+		if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+			v.RegisterTagNameFunc(jsonFieldName)
+		}
+	})
+	raw, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = decodeJSON(raw, dst, StrictDecoding(c.Request.Context()))
+	}
+	if err == nil {
+		err = binding.Validator.ValidateStruct(dst)
+	}
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, ErrBodyTooLarge) {
+		AbortWithTypedError(c, ErrBodyTooLarge)
+		return false
+	}
+	AbortWithError(c, http.StatusBadRequest, ErrorResponse{
+		ErrorCode: ErrorCodeValidationFailed,
+		Fields:    fieldErrors(err, raw, reflect.TypeOf(dst)),
+	})
+	return false
+}
+
+// decodeJSON decodes the single JSON value in raw into dst.
+func decodeJSON(raw []byte, dst interface{}, strict bool) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(dst); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return errors.New("unexpected data after the JSON body")
+	}
+	return nil
+}
+
+// fieldErrors describes err, naming fields by their JSON path from the root
+// of t, the type decoded into, e.g. "components[0].displayName".
+func fieldErrors(err error, raw []byte, t reflect.Type) []FieldError {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   fieldPath(fe.Namespace()),
+				Message: validationMessage(fe),
+			})
+		}
+		return fields
+	case errors.As(err, &typeErr):
+		return []FieldError{{
+			Field:   typeErrorPath(t, typeErr.Field),
+			Message: fmt.Sprintf("must be of type %s", typeErr.Type),
+		}}
+	case errors.As(err, &syntaxErr):
+		return []FieldError{{
+			Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset),
+		}}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		path, _ := unknownField(json.NewDecoder(bytes.NewReader(raw)), t, "")
+		return []FieldError{{
+			Field:   path,
+			Message: "unknown field",
+		}}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return []FieldError{{Message: "malformed JSON: unexpected end of body"}}
+	case errors.Is(err, io.EOF):
+		return []FieldError{{Message: "request body is empty"}}
+	default:
+		return []FieldError{{Message: err.Error()}}
+	}
+}
+
+// fieldPath drops the root struct name from a validator namespace such as
+// "CreateAppRequest.name".
+func fieldPath(namespace string) string {
+	if i := strings.IndexByte(namespace, '.'); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+// typeErrorPath rewrites the dotted path of an UnmarshalTypeError, such as
+// "components.0.displayName", in the validator's notation. Map keys are taken
+// to be a single segment.
+func typeErrorPath(t reflect.Type, dotted string) string {
+	if dotted == "" {
+		return ""
+	}
+	var path string
+	for _, segment := range strings.Split(dotted, ".") {
+		t = indirect(t)
+		switch {
+		case t == nil:
+			path = joinField(path, segment)
+		case t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map:
+			path += "[" + segment + "]"
+			t = t.Elem()
+		case t.Kind() == reflect.Struct:
+			path = joinField(path, segment)
+			t, _ = jsonField(t, segment)
+		default:
+			path = joinField(path, segment)
+			t = nil
+		}
+	}
+	return path
+}
+
+// unknownField walks the JSON value read from dec alongside t and returns
+// the path of the first object key t does not declare, the one
+// DisallowUnknownFields stopped at.
+func unknownField(dec *json.Decoder, t reflect.Type, path string) (string, bool) {
+	t = indirect(t)
+	tok, err := dec.Token()
+	if err != nil {
+		return "", false
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return "", false
+	}
+	switch delim {
+	case '[':
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		for i := 0; dec.More(); i++ {
+			if p, found := unknownField(dec, elem, fmt.Sprintf("%s[%d]", path, i)); found {
+				return p, true
+			}
+		}
+	case '{':
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return "", false
+			}
+			key, _ := tok.(string)
+			var p string
+			var field reflect.Type
+			switch {
+			case t != nil && t.Kind() == reflect.Struct:
+				p = joinField(path, key)
+				if field, ok = jsonField(t, key); !ok {
+					return p, true
+				}
+			case t != nil && t.Kind() == reflect.Map:
+				p, field = path+"["+key+"]", t.Elem()
+			}
+			if p, found := unknownField(dec, field, p); found {
+				return p, true
+			}
+		}
+	}
+	_, _ = dec.Token()
+	return "", false
+}
+
+// jsonField returns the type of the field of struct t that encoding/json
+// decodes key into, looking through embedded structs.
+func jsonField(t reflect.Type, key string) (reflect.Type, bool) {
+	var folded reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonFieldName(f)
+		if f.Anonymous && strings.SplitN(f.Tag.Get("json"), ",", 2)[0] == "" {
+			if embedded := indirect(f.Type); embedded != nil && embedded.Kind() == reflect.Struct {
+				if ft, ok := jsonField(embedded, key); ok {
+					return ft, true
+				}
+				continue
+			}
+		}
+		if !f.IsExported() || name == "" {
+			continue
+		}
+		if name == key {
+			return f.Type, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = f.Type
+		}
+	}
+	return folded, folded != nil
+}
+
+// indirect dereferences pointers; it returns nil for nil and for interface
+// types, whose contents can't be known from the type.
+func indirect(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Interface {
+		return nil
+	}
+	return t
+}
+
+func joinField(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func validationMessage(fe validator.FieldError) string {
+	if fe.Param() != "" {
+		return fmt.Sprintf("failed the %q rule (%s)", fe.Tag(), fe.Param())
+	}
+	return fmt.Sprintf("failed the %q rule", fe.Tag())
+}
+
+func jsonFieldName(f reflect.StructField) string {
+	name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
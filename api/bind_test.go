@@ -0,0 +1,192 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/middleware"
+)
+
+type bindComponent struct {
+	DisplayName string            `json:"displayName" binding:"required"`
+	Props       map[string]string `json:"props"`
+}
+
+type bindEmbedded struct {
+	Owner string `json:"owner"`
+}
+
+type bindRequest struct {
+	bindEmbedded
+	Name       string                   `json:"name" binding:"required"`
+	Components []bindComponent          `json:"components" binding:"dive"`
+	Layout     map[string]bindComponent `json:"layout" binding:"dive"`
+	Extra      interface{}              `json:"extra"`
+}
+
+func TestBindJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		body    string
+		lenient bool
+		status  int
+		fields  []api.FieldError
+	}{
+		{
+			name:   "valid",
+			body:   `{"name":"app","owner":"me","components":[{"displayName":"button1"}],"extra":{"any":[1]}}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "type error",
+			body:   `{"name":"app","components":[{"displayName":"button1"},{"displayName":2}]}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Field: "components[1].displayName", Message: "must be of type string"}},
+		},
+		{
+			name:   "type error in map",
+			body:   `{"name":"app","layout":{"header":{"displayName":"h","props":{"color":1}}}}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Field: "layout[header].props[color]", Message: "must be of type string"}},
+		},
+		{
+			name:   "required",
+			body:   `{"components":[]}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Field: "name", Message: `failed the "required" rule`}},
+		},
+		{
+			name:   "required inside dive",
+			body:   `{"name":"app","components":[{"displayName":"button1"},{}]}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Field: "components[1].displayName", Message: `failed the "required" rule`}},
+		},
+		{
+			name:   "unknown top-level field",
+			body:   `{"name":"app","nam":"typo"}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Field: "nam", Message: "unknown field"}},
+		},
+		{
+			name:   "unknown nested field",
+			body:   `{"name":"app","extra":{"nam":1},"components":[{"displayName":"a"},{"displayNam":"b"}]}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Field: "components[1].displayNam", Message: "unknown field"}},
+		},
+		{
+			name:   "unknown field in map value",
+			body:   `{"name":"app","layout":{"header":{"displayName":"h","prop":{}}}}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Field: "layout[header].prop", Message: "unknown field"}},
+		},
+		{
+			name:   "field names match case-insensitively",
+			body:   `{"Name":"app","OWNER":"me"}`,
+			status: http.StatusOK,
+		},
+		{
+			name:    "unknown field in lenient mode",
+			body:    `{"name":"app","components":[{"displayName":"a","displayNam":"b"}]}`,
+			lenient: true,
+			status:  http.StatusOK,
+		},
+		{
+			name:   "trailing data",
+			body:   `{"name":"app"} {"name":"again"}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Message: "unexpected data after the JSON body"}},
+		},
+		{
+			name:   "trailing brace",
+			body:   `{"name":"app"}}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Message: "unexpected data after the JSON body"}},
+		},
+		{
+			name:   "malformed",
+			body:   `{"name":}`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Message: "malformed JSON at offset 9"}},
+		},
+		{
+			name:   "truncated",
+			body:   `{"name":"app"`,
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Message: "malformed JSON: unexpected end of body"}},
+		},
+		{
+			name:   "empty body",
+			body:   "",
+			status: http.StatusBadRequest,
+			fields: []api.FieldError{{Message: "request body is empty"}},
+		},
+		{
+			name:   "too large",
+			body:   `{"name":"` + strings.Repeat("a", 256) + `"}`,
+			status: http.StatusRequestEntityTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strict := api.StrictDecoding
+			api.StrictDecoding = func(context.Context) bool { return !tt.lenient }
+			defer func() { api.StrictDecoding = strict }()
+
+			r := gin.New()
+			r.Use(middleware.BodyLimit(128))
+			r.POST("/apps", func(c *gin.Context) {
+				var req bindRequest
+				if api.BindJSON(c, &req) {
+					c.Status(http.StatusOK)
+				}
+			})
+			req := httptest.NewRequest(http.MethodPost, "/apps", strings.NewReader(tt.body))
+			req.ContentLength = -1
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+			var resp api.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode body %q: %v", w.Body, err)
+			}
+			wantCode := api.ErrorCodeValidationFailed
+			if tt.status == http.StatusRequestEntityTooLarge {
+				wantCode = api.ErrorCodeBodyTooLarge
+			}
+			if resp.ErrorCode != wantCode {
+				t.Errorf("errorCode = %q, want %q", resp.ErrorCode, wantCode)
+			}
+			if !reflect.DeepEqual(resp.Fields, tt.fields) {
+				t.Errorf("fields = %+v, want %+v", resp.Fields, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes are stable API surface: clients branch on them and every code
+// needs an entry in each locales/*.json catalog.
+const (
+	ErrorCodeValidationFailed = "VALIDATION_FAILED"
+	ErrorCodeBodyTooLarge     = "BODY_TOO_LARGE"
+	ErrorCodeRateLimited      = "RATE_LIMITED"
+	ErrorCodeOriginNotAllowed = "ORIGIN_NOT_ALLOWED"
+	ErrorCodeInternal         = "INTERNAL_ERROR"
+	ErrorCodeMaintenanceMode  = "MAINTENANCE_MODE"
+)
+
+// ErrorCodes lists every code for the MissingTranslations startup check;
+// i18n_test.go fails when a constant is left out.
+var ErrorCodes = []string{
+	ErrorCodeValidationFailed,
+	ErrorCodeBodyTooLarge,
+	ErrorCodeRateLimited,
+	ErrorCodeOriginNotAllowed,
+	ErrorCodeInternal,
+	ErrorCodeMaintenanceMode,
+}
+
+// Error is a typed error carrying its error code and HTTP status.
+type Error struct {
+	Code   string
+	Status int
+	Detail string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// Expected marks client errors as part of normal operation, so they are not
+// sent to the error reporter.
+func (e *Error) Expected() bool {
+	return e.Status < http.StatusInternalServerError
+}
+
+// ErrorResponse is the body of every error response. ErrorMessage is
+// localized for the caller; ErrorDetail keeps the technical, untranslated
+// reason.
+type ErrorResponse struct {
+	ErrorCode    string       `json:"errorCode"`
+	ErrorMessage string       `json:"errorMessage"`
+	ErrorDetail  string       `json:"errorDetail,omitempty"`
+	Fields       []FieldError `json:"fields,omitempty"`
+	RequestID    string       `json:"requestId,omitempty"`
+}
+
+// FieldError names the offending field by its JSON path, e.g. "components[0].displayName".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// AbortWithError writes resp with the given status and stops the handler
+// chain. The message is looked up from resp.ErrorCode in the caller's
+// locale, and the request ID is taken from the response header set by the
+// request ID middleware.
+func AbortWithError(c *gin.Context, status int, resp ErrorResponse) {
+	resp.ErrorMessage = Message(RequestLocale(c), resp.ErrorCode)
+	if resp.RequestID == "" {
+		resp.RequestID = c.Writer.Header().Get("X-Request-ID")
+	}
+	c.AbortWithStatusJSON(status, resp)
+}
+
+// AbortWithTypedError renders err as an error response; errors that are not
+// an *Error become an opaque 500.
+func AbortWithTypedError(c *gin.Context, err error) {
+	var typed *Error
+	if !errors.As(err, &typed) {
+		_ = c.Error(err)
+		AbortWithError(c, http.StatusInternalServerError, ErrorResponse{ErrorCode: ErrorCodeInternal})
+		return
+	}
+	AbortWithError(c, typed.Status, ErrorResponse{
+		ErrorCode:   typed.Code,
+		ErrorDetail: typed.Detail,
+	})
+}
@@ -0,0 +1,158 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const DefaultLocale = "en-US"
+
+// LanguageKey is the gin context key under which authentication stores the
+// user's preferred language; it takes precedence over Accept-Language.
+const LanguageKey = "language"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalogs maps locale -> error code -> message.
+var catalogs = mustLoadCatalogs()
+
+func mustLoadCatalogs() map[string]map[string]string {
+	entries, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		raw, err := localeFiles.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			panic(fmt.Sprintf("parse locale %s: %v", entry.Name(), err))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+	return loaded
+}
+
+// MissingTranslations lists, as "locale: CODE", every error code without a
+// catalog entry.
+func MissingTranslations() []string {
+	var missing []string
+	for locale, messages := range catalogs {
+		for _, code := range ErrorCodes {
+			if _, ok := messages[code]; !ok {
+				missing = append(missing, locale+": "+code)
+			}
+		}
+	}
+	if _, ok := catalogs[DefaultLocale]; !ok {
+		missing = append(missing, DefaultLocale+": catalog")
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Message returns the message for code in locale, falling back to English
+// and then to the code itself.
+func Message(locale, code string) string {
+	if msg, ok := catalogs[locale][code]; ok {
+		return msg
+	}
+	if msg, ok := catalogs[DefaultLocale][code]; ok {
+		return msg
+	}
+	return code
+}
+
+// RequestLocale picks the catalog locale for the request from the user's
+// preference or the Accept-Language header.
+func RequestLocale(c *gin.Context) string {
+	if lang := c.GetString(LanguageKey); lang != "" {
+		if locale, ok := matchLocale(lang); ok {
+			return locale
+		}
+	}
+	for _, lang := range acceptedLanguages(c.GetHeader("Accept-Language")) {
+		if locale, ok := matchLocale(lang); ok {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
+
+// matchLocale matches a language tag exactly, then by primary language
+// ("zh-TW" and "zh" both match "zh-CN").
+func matchLocale(tag string) (string, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	primary := strings.SplitN(tag, "-", 2)[0]
+	fallback := ""
+	for locale := range catalogs {
+		lower := strings.ToLower(locale)
+		if lower == tag {
+			return locale, true
+		}
+		if strings.SplitN(lower, "-", 2)[0] == primary && (fallback == "" || locale < fallback) {
+			fallback = locale
+		}
+	}
+	return fallback, fallback != ""
+}
+
+// acceptedLanguages returns the tags of an Accept-Language header ordered by
+// descending quality.
+func acceptedLanguages(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, weighted{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
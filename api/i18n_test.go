@@ -0,0 +1,216 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCatalogsAreComplete(t *testing.T) {
+	if missing := MissingTranslations(); len(missing) > 0 {
+		t.Errorf("missing translations: %v", missing)
+	}
+}
+
+// usedCode is an error code set where the code base builds an error, either
+// as an ErrorCode* constant or a string literal.
+type usedCode struct {
+	pos      string
+	constant string
+	literal  string
+}
+
+// scanErrorCodes parses the module's sources and returns the value of every
+// ErrorCode* constant in this package, and every code set on an Error or
+// ErrorResponse literal anywhere, so new errors are checked without having
+// to be listed by hand.
+func scanErrorCodes(t *testing.T) (map[string]string, []usedCode) {
+	t.Helper()
+	consts := map[string]string{}
+	var used []usedCode
+	fset := token.NewFileSet()
+	pkgDir, err := filepath.Abs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = filepath.WalkDir("..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != ".." && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		f, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		inAPI := dir == pkgDir
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.ValueSpec:
+				for i, name := range n.Names {
+					if lit, ok := valueAt(n.Values, i).(*ast.BasicLit); ok && inAPI && strings.HasPrefix(name.Name, "ErrorCode") {
+						consts[name.Name], _ = strconv.Unquote(lit.Value)
+					}
+				}
+			case *ast.CompositeLit:
+				key := ""
+				switch typeName(n.Type, inAPI) {
+				case "Error":
+					key = "Code"
+				case "ErrorResponse":
+					key = "ErrorCode"
+				}
+				for _, elt := range n.Elts {
+					kv, ok := elt.(*ast.KeyValueExpr)
+					if !ok || key == "" || identName(kv.Key) != key {
+						continue
+					}
+					u := usedCode{pos: fset.Position(kv.Pos()).String()}
+					if lit, ok := kv.Value.(*ast.BasicLit); ok {
+						u.literal, _ = strconv.Unquote(lit.Value)
+					} else if u.constant = typeName(kv.Value, inAPI); u.constant == "" {
+						// A code passed through, such as typed.Code.
+						continue
+					}
+					used = append(used, u)
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("scan sources: %v", err)
+	}
+	return consts, used
+}
+
+func valueAt(values []ast.Expr, i int) ast.Expr {
+	if i < len(values) {
+		return values[i]
+	}
+	return nil
+}
+
+func identName(e ast.Expr) string {
+	if id, ok := e.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// typeName resolves Name inside this package and api.Name outside it.
+func typeName(e ast.Expr, inAPI bool) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		if inAPI {
+			return e.Name
+		}
+	case *ast.SelectorExpr:
+		if identName(e.X) == "api" {
+			return e.Sel.Name
+		}
+	}
+	return ""
+}
+
+func TestEveryErrorCodeHasMessages(t *testing.T) {
+	consts, used := scanErrorCodes(t)
+	if len(consts) == 0 || len(used) == 0 {
+		t.Fatalf("found %d error code constants and %d uses; the scan is broken", len(consts), len(used))
+	}
+	listed := map[string]bool{}
+	for _, code := range ErrorCodes {
+		listed[code] = true
+	}
+	for name, code := range consts {
+		if !listed[code] {
+			t.Errorf("%s (%s) is missing from ErrorCodes", name, code)
+		}
+	}
+	for _, u := range used {
+		code := u.literal
+		if u.constant != "" {
+			var ok bool
+			if code, ok = consts[u.constant]; !ok {
+				t.Errorf("%s: error code %s is not an api.ErrorCode* constant", u.pos, u.constant)
+				continue
+			}
+		}
+		for locale, messages := range catalogs {
+			if _, ok := messages[code]; !ok {
+				t.Errorf("%s: %s has no message in locales/%s.json", u.pos, code, locale)
+			}
+		}
+	}
+}
+
+func TestRequestLocale(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", DefaultLocale},
+		{"ja-JP", "ja-JP"},
+		{"zh_CN", "zh-CN"},
+		{"zh-TW", "zh-CN"},
+		{"ZH", "zh-CN"},
+		{"fr-FR, ja;q=0.8", "ja-JP"},
+		{"fr-FR;q=1, de;q=0.9", DefaultLocale},
+		{"en-US;q=0.5, zh-CN;q=0.9", "zh-CN"},
+		{"ja; q=0.9, zh-CN ; q=0.95", "zh-CN"},
+		{"zh-CN;q=0, ja-JP;q=0.1", "ja-JP"},
+		{"*, ja-JP;q=0.5", "ja-JP"},
+	}
+	for _, tt := range tests {
+		locale := DefaultLocale
+		for _, lang := range acceptedLanguages(tt.header) {
+			if matched, ok := matchLocale(lang); ok {
+				locale = matched
+				break
+			}
+		}
+		if locale != tt.want {
+			t.Errorf("Accept-Language %q: locale = %q, want %q", tt.header, locale, tt.want)
+		}
+	}
+}
+
+func TestAcceptedLanguagesOrder(t *testing.T) {
+	got := acceptedLanguages("de;q=0.3, fr, en-GB;q=0.7, ja;q=0.7, it;q=0")
+	want := []string{"fr", "en-GB", "ja", "de"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("acceptedLanguages = %v, want %v", got, want)
+	}
+}
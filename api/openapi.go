@@ -0,0 +1,71 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+type openAPIDocument struct {
+	Paths map[string]map[string]interface{} `yaml:"paths"`
+}
+
+// OpenAPISpecJSON returns the embedded OpenAPI document rendered as JSON.
+func OpenAPISpecJSON() ([]byte, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(openAPIYAML, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// UndocumentedRoutes lists the registered routes, as "METHOD /path", which
+// have no matching operation in the OpenAPI document.
+func UndocumentedRoutes(routes gin.RoutesInfo) ([]string, error) {
+	var doc openAPIDocument
+	if err := yaml.Unmarshal(openAPIYAML, &doc); err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, route := range routes {
+		operations, ok := doc.Paths[openAPIPath(route.Path)]
+		if _, documented := operations[strings.ToLower(route.Method)]; !ok || !documented {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
+
+// openAPIPath converts a gin route template such as /apps/:id into the
+// OpenAPI form /apps/{id}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
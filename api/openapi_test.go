@@ -0,0 +1,107 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/health"
+	"github.com/illa-family/builder-backend/internal/router"
+)
+
+type schema struct {
+	Required   []string               `json:"required"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// TestSchemasMatchStructs keeps the hand-written component schemas in step
+// with the Go types they describe: the same properties, with exactly the
+// fields that are never omitted marked required.
+func TestSchemasMatchStructs(t *testing.T) {
+	raw, err := api.OpenAPISpecJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Components struct {
+			Schemas map[string]schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	types := map[string]interface{}{
+		"ErrorResponse":    api.ErrorResponse{},
+		"FieldError":       api.FieldError{},
+		"DependencyStatus": health.DependencyStatus{},
+		"Maintenance":      router.MaintenanceRequest{},
+	}
+	for name, v := range types {
+		s, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is missing", name)
+			continue
+		}
+		var properties []string
+		for property := range s.Properties {
+			properties = append(properties, property)
+		}
+		fields, required := jsonFields(reflect.TypeOf(v))
+		sort.Strings(properties)
+		sort.Strings(s.Required)
+		if !reflect.DeepEqual(properties, fields) {
+			t.Errorf("schema %s has properties %v, %T has fields %v", name, properties, v, fields)
+		}
+		if !reflect.DeepEqual(s.Required, required) {
+			t.Errorf("schema %s requires %v, %T never omits %v", name, s.Required, v, required)
+		}
+	}
+}
+
+// jsonFields returns the sorted JSON names of t's fields, and those without
+// omitempty.
+func jsonFields(t reflect.Type) (fields, required []string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		parts := strings.Split(f.Tag.Get("json"), ",")
+		name := parts[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, name)
+		omitempty := false
+		for _, opt := range parts[1:] {
+			omitempty = omitempty || opt == "omitempty"
+		}
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(fields)
+	sort.Strings(required)
+	return fields, required
+}
@@ -0,0 +1,35 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"embed"
+	"path"
+)
+
+// SwaggerUIVersion is the swagger-ui-dist release vendored in swagger-ui/.
+const SwaggerUIVersion = "4.15.5"
+
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js
+var swaggerUIFiles embed.FS
+
+// SwaggerUIAsset returns a vendored Swagger UI file by its base name.
+func SwaggerUIAsset(name string) ([]byte, bool) {
+	if name != path.Base(name) {
+		return nil, false
+	}
+	data, err := swaggerUIFiles.ReadFile(path.Join("swagger-ui", name))
+	return data, err == nil
+}
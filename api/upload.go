@@ -20,8 +20,8 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-var UpGrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+func NewUpGrader(checkOrigin func(r *http.Request) bool) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		CheckOrigin: checkOrigin,
+	}
 }
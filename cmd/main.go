@@ -15,19 +15,119 @@
 package main
 
 import (
-	"github.com/gin-gonic/gin"
-	"github.com/illa-family/builder-backend/internal/router"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/config"
+	"github.com/illa-family/builder-backend/internal/feature"
+	"github.com/illa-family/builder-backend/internal/logger"
+	"github.com/illa-family/builder-backend/internal/reporter"
+	"github.com/illa-family/builder-backend/internal/tracing"
+	"go.uber.org/zap"
 )
 
 func main() {
-	r := gin.Default()
-	pingRouter := r.Group("/ping")
-	{
-		pingRouter.GET("", router.Ping())
+	os.Exit(run())
+}
+
+func run() int {
+	validateOnly := flag.Bool("validate-config", false, "validate the configuration and exit")
+	flag.Parse()
+
+	zapLogger, err := logger.New()
+	if err != nil {
+		log.Printf("init logger: %v", err)
+		return 1
+	}
+	defer func() { _ = zapLogger.Sync() }()
+	zap.ReplaceGlobals(zapLogger)
+
+	cfg, err := config.Load()
+	if err != nil {
+		zapLogger.Error("load config", zap.Error(err))
+		return 1
 	}
-	realtimeRouter := r.Group("/realtime")
-	{
-		realtimeRouter.GET("/ping", router.WsPing())
+	for _, warning := range cfg.Warnings {
+		zapLogger.Warn("deprecated config", zap.String("detail", warning))
+	}
+	zapLogger.Info("effective config", zap.Any("config", cfg.Redacted()))
+	if *validateOnly {
+		fmt.Println("configuration is valid")
+		return 0
+	}
+
+	rep := reporter.Noop()
+	if cfg.Reporter.Provider == config.ReporterSentry {
+		rep, err = reporter.NewSentry(cfg.Reporter.SentryDSN, cfg.Reporter.Environment)
+		if err != nil {
+			zapLogger.Error("init error reporter", zap.Error(err))
+			return 1
+		}
+	}
+	defer rep.Flush(2 * time.Second)
+
+	if cfg.Tracing.Exporter == config.TracesExporterOTLP {
+		shutdownTracing, err := tracing.Setup(context.Background())
+		if err != nil {
+			zapLogger.Error("init tracing", zap.Error(err))
+			return 1
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = shutdownTracing(ctx)
+		}()
+	}
+
+	srv, err := newServer(cfg, zapLogger, rep)
+	if err != nil {
+		zapLogger.Error("init server", zap.Error(err))
+		return 1
+	}
+
+	flags := feature.NewService(cfg.Flags(), nil)
+	zapLogger.Info("feature flags", zap.Any("flags", flags.List(context.Background())))
+	api.StrictDecoding = func(ctx context.Context) bool {
+		return flags.Enabled(ctx, feature.StrictJSONDecoding)
+	}
+	if missing := api.MissingTranslations(); len(missing) > 0 {
+		zapLogger.Error("error message catalogs are incomplete", zap.Strings("missing", missing))
+		return 1
+	}
+	r, err := srv.routes()
+	if err != nil {
+		zapLogger.Error("init routes", zap.Error(err))
+		return 1
+	}
+	undocumented, err := api.UndocumentedRoutes(r.Routes())
+	if err != nil {
+		zapLogger.Error("check openapi spec", zap.Error(err))
+		return 1
+	}
+	for _, route := range undocumented {
+		zapLogger.Warn("route missing from openapi spec", zap.String("route", route))
+	}
+
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(cfg.Server.Port))
+	if err != nil {
+		zapLogger.Error("listen", zap.Error(err))
+		return 1
 	}
-	_ = r.Run() // listen and serve on 0.0.0.0:8080 (for windows "localhost:8080")
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// Restore the default handling so a second signal kills the process.
+		<-ctx.Done()
+		stop()
+	}()
+	return srv.serve(ctx, ln, r)
 }
@@ -0,0 +1,202 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/config"
+	"github.com/illa-family/builder-backend/internal/cors"
+	"github.com/illa-family/builder-backend/internal/health"
+	"github.com/illa-family/builder-backend/internal/maintenance"
+	"github.com/illa-family/builder-backend/internal/metrics"
+	"github.com/illa-family/builder-backend/internal/middleware"
+	"github.com/illa-family/builder-backend/internal/ratelimit"
+	"github.com/illa-family/builder-backend/internal/realtime"
+	"github.com/illa-family/builder-backend/internal/reporter"
+	"github.com/illa-family/builder-backend/internal/router"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.uber.org/zap"
+)
+
+// server holds the long-lived components the routes are built from.
+type server struct {
+	cfg         config.Config
+	logger      *zap.Logger
+	reporter    reporter.Reporter
+	registry    *prometheus.Registry
+	httpMetrics *metrics.HTTPMetrics
+	wsMetrics   *metrics.WebsocketMetrics
+	checker     *health.Checker
+	wsConns     *realtime.Connections
+	maintenance *maintenance.Switch
+	cors        *cors.Policy
+	spec        []byte
+}
+
+func newServer(cfg config.Config, zapLogger *zap.Logger, rep reporter.Reporter) (*server, error) {
+	spec, err := api.OpenAPISpecJSON()
+	if err != nil {
+		return nil, err
+	}
+	corsPolicy, err := cors.NewPolicy(cfg.CORS.AllowedOrigins, cfg.CORS.AllowCredentials, cfg.CORS.MaxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	s := &server{
+		cfg:         cfg,
+		logger:      zapLogger,
+		reporter:    rep,
+		registry:    registry,
+		httpMetrics: metrics.NewHTTPMetrics(registry),
+		wsMetrics:   metrics.NewWebsocketMetrics(registry),
+		checker:     health.NewChecker(health.DefaultCheckTimeout, health.DefaultCacheTTL),
+		wsConns:     realtime.NewConnections(),
+		maintenance: maintenance.NewSwitch(maintenance.NewMemoryStore(cfg.Maintenance.Enabled), maintenance.DefaultCacheTTL),
+		cors:        corsPolicy,
+		spec:        spec,
+	}
+	s.maintenance.OnChange(func(enabled bool) {
+		zapLogger.Info("maintenance mode switched", zap.Bool("enabled", enabled))
+		notice, _ := json.Marshal(gin.H{"type": "maintenance", "enabled": enabled})
+		if !s.wsConns.Broadcast(notice) {
+			zapLogger.Warn("maintenance notice dropped")
+		}
+	})
+	s.checker.RegisterInfo("maintenance", func(ctx context.Context) interface{} {
+		return s.maintenance.Enabled(ctx)
+	})
+	return s, nil
+}
+
+// routes builds the engine with the middleware chain and every route the
+// configuration enables.
+func (s *server) routes() (*gin.Engine, error) {
+	cfg := s.cfg
+	r := gin.New()
+	// gin trusts X-Forwarded-For from any peer by default, which would let
+	// clients pick the IP the rate limiter keys on.
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
+	r.Use(middleware.RequestID(s.logger), middleware.Tracing(), middleware.AccessLog(), s.httpMetrics.Middleware(), middleware.Recover(s.reporter))
+	r.Use(s.cors.Middleware(), middleware.BodyLimit(cfg.Request.MaxBodyBytes))
+	r.Use(middleware.ReadOnlyDuringMaintenance(s.maintenance, "/admin/maintenance"))
+	// Limiters are mounted per group: probes and metrics scrapes are never
+	// limited, and routes checking credentials get the stricter auth bucket
+	// ahead of the check.
+	store := ratelimit.NewMemoryStore(ratelimit.SystemClock())
+	rateLimit := func(bucket string, rate float64, burst int) []gin.HandlerFunc {
+		if !cfg.RateLimit.Enabled {
+			return nil
+		}
+		return []gin.HandlerFunc{middleware.RateLimit(store, bucket, ratelimit.Limit{Rate: rate, Burst: burst})}
+	}
+	apiLimit := rateLimit("api", cfg.RateLimit.APIRate, cfg.RateLimit.APIBurst)
+	authLimit := rateLimit("auth", cfg.RateLimit.AuthRate, cfg.RateLimit.AuthBurst)
+
+	pingRouter := r.Group("/ping")
+	{
+		pingRouter.GET("", router.Ping())
+	}
+	r.GET("/healthz", router.Healthz())
+	r.GET("/readyz", router.Readyz(s.checker))
+	docsRouter := r.Group("", apiLimit...)
+	{
+		docsRouter.GET("/swagger.json", router.OpenAPISpec(s.spec))
+		if cfg.Swagger.UIEnabled {
+			docsRouter.GET("/swagger", router.SwaggerUI())
+			docsRouter.GET("/swagger/:asset", router.SwaggerUIAsset())
+		}
+	}
+	realtimeRouter := r.Group("/realtime", apiLimit...)
+	{
+		upGrader := api.NewUpGrader(s.cors.CheckOrigin)
+		realtimeRouter.GET("/ping", router.WsPing(upGrader, s.wsMetrics, s.wsConns, s.reporter))
+	}
+	if cfg.Metrics.Enabled {
+		metricsRouter := r.Group("/metrics")
+		if cfg.Metrics.Username != "" {
+			metricsRouter.Use(authLimit...)
+			metricsRouter.Use(gin.BasicAuth(gin.Accounts{cfg.Metrics.Username: cfg.Metrics.Password}))
+		}
+		metricsRouter.GET("", router.Metrics(s.registry))
+	}
+	if cfg.Admin.Username != "" {
+		adminRouter := r.Group("/admin", authLimit...)
+		adminRouter.Use(gin.BasicAuth(gin.Accounts{cfg.Admin.Username: cfg.Admin.Password}))
+		{
+			adminRouter.GET("/maintenance", router.GetMaintenance(s.maintenance))
+			adminRouter.PUT("/maintenance", router.SetMaintenance(s.maintenance))
+		}
+	}
+	return r, nil
+}
+
+// serve handles requests on ln until ctx is done. It then fails readiness,
+// keeps serving for the shutdown delay, and waits for in-flight requests and
+// closes the websocket connections within the shutdown timeout. It returns
+// the process exit code.
+func (s *server) serve(ctx context.Context, ln net.Listener, handler http.Handler) int {
+	httpServer := &http.Server{Handler: handler}
+	serveErr := make(chan error, 1)
+	go func() {
+		s.logger.Info("listening", zap.String("addr", ln.Addr().String()))
+		serveErr <- httpServer.Serve(ln)
+	}()
+	select {
+	case err := <-serveErr:
+		s.logger.Error("server stopped", zap.Error(err))
+		return 1
+	case <-ctx.Done():
+	}
+
+	delay, timeout := s.cfg.Server.ShutdownDelay, s.cfg.Server.ShutdownTimeout
+	s.logger.Info("shutting down", zap.Duration("delay", delay), zap.Duration("timeout", timeout))
+	s.checker.SetShuttingDown()
+	// Keep serving while probes observe the failing readiness.
+	time.Sleep(delay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	exitCode := 0
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		s.logger.Error("in-flight requests did not finish in time", zap.Error(err))
+		exitCode = 1
+	}
+	if err := s.wsConns.Drain(shutdownCtx); err != nil {
+		s.logger.Error("websocket connections did not close in time", zap.Error(err))
+		exitCode = 1
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Error("server stopped", zap.Error(err))
+		exitCode = 1
+	}
+	return exitCode
+}
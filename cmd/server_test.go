@@ -0,0 +1,272 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/config"
+	"github.com/illa-family/builder-backend/internal/reporter"
+	"go.uber.org/zap"
+)
+
+// allRoutesConfig enables every optional route group.
+func allRoutesConfig() config.Config {
+	cfg := config.Default()
+	cfg.Metrics.Enabled = true
+	cfg.Swagger.UIEnabled = true
+	cfg.RateLimit.Enabled = true
+	cfg.Admin.Username = "admin"
+	cfg.Admin.Password = "admin-password"
+	return cfg
+}
+
+func newTestServer(t *testing.T, cfg config.Config) *server {
+	t.Helper()
+	srv, err := newServer(cfg, zap.NewNop(), reporter.Noop())
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+	return srv
+}
+
+func newTestRoutes(t *testing.T, srv *server) *gin.Engine {
+	t.Helper()
+	r, err := srv.routes()
+	if err != nil {
+		t.Fatalf("routes: %v", err)
+	}
+	return r
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	if _, err := api.OpenAPISpecJSON(); err != nil {
+		t.Fatalf("OpenAPISpecJSON: %v", err)
+	}
+	r := newTestRoutes(t, newTestServer(t, allRoutesConfig()))
+	undocumented, err := api.UndocumentedRoutes(r.Routes())
+	if err != nil {
+		t.Fatalf("UndocumentedRoutes: %v", err)
+	}
+	if len(undocumented) > 0 {
+		t.Errorf("routes missing from api/openapi.yaml: %v", undocumented)
+	}
+}
+
+func TestForwardedForIsIgnoredFromUntrustedPeers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := allRoutesConfig()
+	cfg.RateLimit.APIBurst = 1
+	r := newTestRoutes(t, newTestServer(t, cfg))
+
+	codes := make([]int, 0, 2)
+	for _, forwardedFor := range []string{"203.0.113.1", "203.0.113.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/swagger.json", nil)
+		req.RemoteAddr = "192.0.2.10:40000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("status codes = %v, want [200 429]", codes)
+	}
+}
+
+func TestForwardedForIsUsedFromTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := allRoutesConfig()
+	cfg.RateLimit.APIBurst = 1
+	cfg.Server.TrustedProxies = []string{"192.0.2.0/24"}
+	r := newTestRoutes(t, newTestServer(t, cfg))
+
+	for _, forwardedFor := range []string{"203.0.113.1", "203.0.113.2"} {
+		req := httptest.NewRequest(http.MethodGet, "/swagger.json", nil)
+		req.RemoteAddr = "192.0.2.10:40000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("client %s: status = %d, want 200", forwardedFor, w.Code)
+		}
+	}
+}
+
+type getResult struct {
+	status int
+	body   string
+	err    error
+}
+
+// get requests url in the background and delivers the outcome on the
+// returned channel.
+func get(url string) <-chan getResult {
+	done := make(chan getResult, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			done <- getResult{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		done <- getResult{status: resp.StatusCode, body: string(body), err: err}
+	}()
+	return done
+}
+
+// startServe runs srv.serve on a loopback listener until ctx is done. It
+// returns the base URL and the channel carrying the exit code.
+func startServe(t *testing.T, ctx context.Context, srv *server, handler http.Handler) (string, <-chan int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	exitCode := make(chan int, 1)
+	go func() { exitCode <- srv.serve(ctx, ln, handler) }()
+	return "http://" + ln.Addr().String(), exitCode
+}
+
+func TestSIGTERMLetsInFlightRequestsFinish(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	cfg.Server.ShutdownDelay = 300 * time.Millisecond
+	srv := newTestServer(t, cfg)
+	r := newTestRoutes(t, srv)
+	started := make(chan struct{})
+	r.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(500 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+	base, exitCode := startServe(t, ctx, srv, r)
+	done := get(base + "/slow")
+
+	<-started
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("send SIGTERM: %v", err)
+	}
+	// During the shutdown delay the listener is still open and readiness
+	// reports the server as draining.
+	deadline := time.Now().Add(cfg.Server.ShutdownDelay)
+	for {
+		res := <-get(base + "/readyz")
+		if res.err != nil {
+			t.Fatalf("readiness during shutdown delay: %v", res.err)
+		}
+		if res.status == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("readiness status = %d during shutdown delay, want 503", res.status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	res := <-done
+	if res.err != nil || res.status != http.StatusOK || res.body != "done" {
+		t.Fatalf("in-flight request: status=%d body=%q err=%v, want 200 \"done\"", res.status, res.body, res.err)
+	}
+	select {
+	case code := <-exitCode:
+		if code != 0 {
+			t.Errorf("exit code = %d, want 0", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after shutdown")
+	}
+}
+
+func TestShutdownTimeoutExitsNonZero(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	cfg.Server.ShutdownDelay = 0
+	cfg.Server.ShutdownTimeout = 50 * time.Millisecond
+	srv := newTestServer(t, cfg)
+	r := newTestRoutes(t, srv)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	r.GET("/stuck", func(c *gin.Context) {
+		close(started)
+		<-release
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	base, exitCode := startServe(t, ctx, srv, r)
+	get(base + "/stuck")
+	<-started
+	cancel()
+	select {
+	case code := <-exitCode:
+		if code != 1 {
+			t.Errorf("exit code = %d, want 1", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the shutdown timeout")
+	}
+}
+
+func TestRateLimitedGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := allRoutesConfig()
+	cfg.RateLimit.APIBurst = 1
+	cfg.RateLimit.AuthBurst = 1
+	r := newTestRoutes(t, newTestServer(t, cfg))
+	statuses := func(path string, n int, password string) []int {
+		codes := make([]int, n)
+		for i := range codes {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.RemoteAddr = "192.0.2.10:40000"
+			if password != "" {
+				req.SetBasicAuth(cfg.Admin.Username, password)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}
+		return codes
+	}
+
+	for _, probe := range []string{"/ping", "/healthz", "/readyz", "/metrics"} {
+		for _, code := range statuses(probe, 3, "") {
+			if code == http.StatusTooManyRequests {
+				t.Errorf("%s was rate limited", probe)
+			}
+		}
+	}
+	if got := statuses("/swagger.json", 2, ""); got[1] != http.StatusTooManyRequests {
+		t.Errorf("/swagger.json statuses = %v, want the api bucket to limit the second", got)
+	}
+	if got := statuses("/admin/maintenance", 2, "wrong-password"); got[0] != http.StatusUnauthorized || got[1] != http.StatusTooManyRequests {
+		t.Errorf("/admin/maintenance statuses = %v, want [401 429]", got)
+	}
+}
@@ -0,0 +1,467 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/illa-family/builder-backend/internal/cors"
+	"github.com/illa-family/builder-backend/internal/feature"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFileEnv names an optional YAML file that is loaded before the
+// environment; environment variables override values from the file.
+const ConfigFileEnv = "ILLA_CONFIG_FILE"
+
+const (
+	minSecretLength = 12
+	redacted        = "******"
+)
+
+type Config struct {
+	Server      ServerConfig      `yaml:"server" json:"server"`
+	Metrics     MetricsConfig     `yaml:"metrics" json:"metrics"`
+	Swagger     SwaggerConfig     `yaml:"swagger" json:"swagger"`
+	RateLimit   RateLimitConfig   `yaml:"rateLimit" json:"rateLimit"`
+	Reporter    ReporterConfig    `yaml:"errorReporter" json:"errorReporter"`
+	Tracing     TracingConfig     `yaml:"tracing" json:"tracing"`
+	CORS        CORSConfig        `yaml:"cors" json:"cors"`
+	Request     RequestConfig     `yaml:"request" json:"request"`
+	Admin       AdminConfig       `yaml:"admin" json:"admin"`
+	Maintenance MaintenanceConfig `yaml:"maintenance" json:"maintenance"`
+	// FeatureFlags overrides flag defaults for the whole instance.
+	FeatureFlags map[string]bool `yaml:"featureFlags" json:"featureFlags"`
+	// Warnings lists deprecated settings found while loading.
+	Warnings []string `yaml:"-" json:"-"`
+}
+
+type ServerConfig struct {
+	Port            int           `yaml:"port" json:"port"`
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" json:"shutdownTimeout"`
+	// ShutdownDelay is how long readiness fails before the listener closes,
+	// so load balancers stop routing here first. It should exceed the
+	// readiness probe period.
+	ShutdownDelay time.Duration `yaml:"shutdownDelay" json:"shutdownDelay"`
+	// TrustedProxies lists the IPs or CIDRs of the reverse proxies whose
+	// X-Forwarded-For header is believed. With none, the client IP is always
+	// the connection's remote address.
+	TrustedProxies []string `yaml:"trustedProxies" json:"trustedProxies"`
+}
+
+type MetricsConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled"`
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+}
+
+type SwaggerConfig struct {
+	UIEnabled bool `yaml:"uiEnabled" json:"uiEnabled"`
+}
+
+// RateLimitConfig sets the token buckets, in requests per second: api for
+// regular routes, and the stricter auth for routes checking credentials.
+type RateLimitConfig struct {
+	Enabled   bool    `yaml:"enabled" json:"enabled"`
+	APIRate   float64 `yaml:"apiRate" json:"apiRate"`
+	APIBurst  int     `yaml:"apiBurst" json:"apiBurst"`
+	AuthRate  float64 `yaml:"authRate" json:"authRate"`
+	AuthBurst int     `yaml:"authBurst" json:"authBurst"`
+}
+
+const (
+	ReporterNone   = "none"
+	ReporterSentry = "sentry"
+)
+
+type ReporterConfig struct {
+	Provider    string `yaml:"provider" json:"provider"`
+	SentryDSN   string `yaml:"sentryDSN" json:"sentryDSN"`
+	Environment string `yaml:"environment" json:"environment"`
+}
+
+const (
+	TracesExporterNone = "none"
+	TracesExporterOTLP = "otlp"
+)
+
+// TracingConfig only selects the exporter; the OTLP exporter itself is
+// configured through the standard OTEL_EXPORTER_OTLP_* variables.
+type TracingConfig struct {
+	Exporter string `yaml:"exporter" json:"exporter"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowedOrigins" json:"allowedOrigins"`
+	AllowCredentials bool          `yaml:"allowCredentials" json:"allowCredentials"`
+	MaxAge           time.Duration `yaml:"maxAge" json:"maxAge"`
+}
+
+// AdminConfig holds the basic-auth credentials of the admin endpoints, which
+// are not served when no username is set.
+type AdminConfig struct {
+	Username string `yaml:"username" json:"username"`
+	Password string `yaml:"password" json:"password"`
+}
+
+type MaintenanceConfig struct {
+	// Enabled starts the instance in maintenance mode.
+	Enabled bool `yaml:"enabled" json:"enabled"`
+}
+
+type RequestConfig struct {
+	// MaxBodyBytes is the default body size limit; route groups with
+	// different needs (auth, import) apply their own BodyLimit, which
+	// replaces this one.
+	MaxBodyBytes int64 `yaml:"maxBodyBytes" json:"maxBodyBytes"`
+	// AllowUnknownJSONFields is the deprecated spelling of
+	// featureFlags.strict_json_decoding=false.
+	AllowUnknownJSONFields *bool `yaml:"allowUnknownJSONFields,omitempty" json:"-"`
+}
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            8080,
+			ShutdownTimeout: 30 * time.Second,
+			ShutdownDelay:   5 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			APIRate:   20,
+			APIBurst:  40,
+			AuthRate:  0.2,
+			AuthBurst: 5,
+		},
+		Reporter: ReporterConfig{
+			Provider: ReporterNone,
+		},
+		Tracing: TracingConfig{
+			Exporter: TracesExporterNone,
+		},
+		CORS: CORSConfig{
+			MaxAge: 10 * time.Minute,
+		},
+		Request: RequestConfig{
+			MaxBodyBytes: 1 << 20,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the optional config file
+// and the environment, then validates it. All problems are reported at once.
+func Load() (Config, error) {
+	cfg := Default()
+	var problems []string
+	if path := os.Getenv(ConfigFileEnv); path != "" {
+		var err error
+		if problems, err = cfg.decodeFile(path); err != nil {
+			return cfg, err
+		}
+	}
+
+	env := &envLoader{}
+	env.int("PORT", &cfg.Server.Port)
+	env.int("ILLA_SERVER_PORT", &cfg.Server.Port)
+	env.seconds("ILLA_SHUTDOWN_TIMEOUT_SECONDS", &cfg.Server.ShutdownTimeout)
+	env.seconds("ILLA_SHUTDOWN_DELAY_SECONDS", &cfg.Server.ShutdownDelay)
+	env.list("ILLA_TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+	env.bool("ILLA_METRICS_ENABLED", &cfg.Metrics.Enabled)
+	env.string("ILLA_METRICS_USERNAME", &cfg.Metrics.Username)
+	env.string("ILLA_METRICS_PASSWORD", &cfg.Metrics.Password)
+	env.bool("ILLA_SWAGGER_UI_ENABLED", &cfg.Swagger.UIEnabled)
+	env.bool("ILLA_RATE_LIMIT_ENABLED", &cfg.RateLimit.Enabled)
+	env.float("ILLA_RATE_LIMIT_API_RATE", &cfg.RateLimit.APIRate)
+	env.int("ILLA_RATE_LIMIT_API_BURST", &cfg.RateLimit.APIBurst)
+	env.float("ILLA_RATE_LIMIT_AUTH_RATE", &cfg.RateLimit.AuthRate)
+	env.int("ILLA_RATE_LIMIT_AUTH_BURST", &cfg.RateLimit.AuthBurst)
+	env.string("ILLA_ERROR_REPORTER", &cfg.Reporter.Provider)
+	env.string("ILLA_SENTRY_DSN", &cfg.Reporter.SentryDSN)
+	env.string("ILLA_SENTRY_ENVIRONMENT", &cfg.Reporter.Environment)
+	env.string("OTEL_TRACES_EXPORTER", &cfg.Tracing.Exporter)
+	env.list("ILLA_CORS_ALLOWED_ORIGINS", &cfg.CORS.AllowedOrigins)
+	env.bool("ILLA_CORS_ALLOW_CREDENTIALS", &cfg.CORS.AllowCredentials)
+	env.seconds("ILLA_CORS_MAX_AGE_SECONDS", &cfg.CORS.MaxAge)
+	env.int64("ILLA_MAX_BODY_BYTES", &cfg.Request.MaxBodyBytes)
+	cfg.applyAllowUnknownJSONFields(env)
+	env.flags("ILLA_FEATURE_FLAGS", &cfg.FeatureFlags)
+	env.string("ILLA_ADMIN_USERNAME", &cfg.Admin.Username)
+	env.string("ILLA_ADMIN_PASSWORD", &cfg.Admin.Password)
+	env.bool("ILLA_MAINTENANCE_MODE", &cfg.Maintenance.Enabled)
+
+	problems = append(problems, env.problems...)
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// decodeFile merges the YAML file at path over c. Unknown keys and values of
+// the wrong type are returned as problems so they are reported with the rest;
+// an unreadable or malformed file is an error.
+func (c *Config) decodeFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	err = dec.Decode(c)
+	var typeErr *yaml.TypeError
+	switch {
+	case err == nil, errors.Is(err, io.EOF):
+		return nil, nil
+	case errors.As(err, &typeErr):
+		problems := make([]string, len(typeErr.Errors))
+		for i, msg := range typeErr.Errors {
+			problems[i] = "config file " + path + ": " + msg
+		}
+		return problems, nil
+	default:
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+}
+
+const allowUnknownJSONFieldsEnv = "ILLA_ALLOW_UNKNOWN_JSON_FIELDS"
+
+// applyAllowUnknownJSONFields maps the setting that predates the
+// strict_json_decoding flag onto it. The flag itself wins when both are set
+// at the same level.
+func (c *Config) applyAllowUnknownJSONFields(env *envLoader) {
+	flag := feature.StrictJSONDecoding.String()
+	set := func(allow bool, source string, override bool) {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("%s is deprecated, use the %s=%t feature flag", source, flag, !allow))
+		if _, ok := c.FeatureFlags[flag]; ok && !override {
+			return
+		}
+		if c.FeatureFlags == nil {
+			c.FeatureFlags = map[string]bool{}
+		}
+		c.FeatureFlags[flag] = !allow
+	}
+	if allow := c.Request.AllowUnknownJSONFields; allow != nil {
+		set(*allow, "request.allowUnknownJSONFields", false)
+	}
+	if _, ok := os.LookupEnv(allowUnknownJSONFieldsEnv); ok {
+		before := len(env.problems)
+		var allow bool
+		env.bool(allowUnknownJSONFieldsEnv, &allow)
+		if len(env.problems) == before {
+			set(allow, allowUnknownJSONFieldsEnv, true)
+		}
+	}
+}
+
+func (c Config) validate() []string {
+	var problems []string
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("server port %d is out of range 1-65535", c.Server.Port))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server shutdown timeout must be positive")
+	}
+	if c.Server.ShutdownDelay < 0 {
+		problems = append(problems, "server shutdown delay must not be negative")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Sprintf("trusted proxy %q is not an IP address or CIDR", proxy))
+		}
+	}
+	if c.Metrics.Username != "" && len(c.Metrics.Password) < minSecretLength {
+		problems = append(problems, fmt.Sprintf("metrics password must be at least %d characters", minSecretLength))
+	}
+	if c.Admin.Username != "" && len(c.Admin.Password) < minSecretLength {
+		problems = append(problems, fmt.Sprintf("admin password must be at least %d characters", minSecretLength))
+	}
+	if c.RateLimit.Enabled {
+		if c.RateLimit.APIRate <= 0 {
+			problems = append(problems, "rate limit api rate must be positive")
+		}
+		if c.RateLimit.APIBurst < 1 {
+			problems = append(problems, "rate limit api burst must be at least 1")
+		}
+		if c.RateLimit.AuthRate <= 0 {
+			problems = append(problems, "rate limit auth rate must be positive")
+		}
+		if c.RateLimit.AuthBurst < 1 {
+			problems = append(problems, "rate limit auth burst must be at least 1")
+		}
+	}
+	switch c.Reporter.Provider {
+	case ReporterNone:
+	case ReporterSentry:
+		if _, err := sentry.NewDsn(c.Reporter.SentryDSN); err != nil {
+			problems = append(problems, "error reporter sentry requires a valid sentry DSN")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown error reporter %q", c.Reporter.Provider))
+	}
+	if c.Tracing.Exporter != TracesExporterNone && c.Tracing.Exporter != TracesExporterOTLP {
+		problems = append(problems, fmt.Sprintf("unsupported traces exporter %q", c.Tracing.Exporter))
+	}
+	if c.Request.MaxBodyBytes <= 0 {
+		problems = append(problems, "max request body size must be positive")
+	}
+	for name := range c.FeatureFlags {
+		if _, ok := feature.Lookup(name); !ok {
+			problems = append(problems, fmt.Sprintf("unknown feature flag %q", name))
+		}
+	}
+	if _, err := cors.NewPolicy(c.CORS.AllowedOrigins, c.CORS.AllowCredentials, c.CORS.MaxAge); err != nil {
+		problems = append(problems, "cors: "+err.Error())
+	}
+	return problems
+}
+
+// Flags returns the instance-level feature flag overrides.
+func (c Config) Flags() map[feature.Flag]bool {
+	flags := make(map[feature.Flag]bool, len(c.FeatureFlags))
+	for name, enabled := range c.FeatureFlags {
+		if flag, ok := feature.Lookup(name); ok {
+			flags[flag] = enabled
+		}
+	}
+	return flags
+}
+
+// Redacted returns a copy safe to log, with every secret masked.
+func (c Config) Redacted() Config {
+	if c.Metrics.Password != "" {
+		c.Metrics.Password = redacted
+	}
+	if c.Admin.Password != "" {
+		c.Admin.Password = redacted
+	}
+	if c.Reporter.SentryDSN != "" {
+		c.Reporter.SentryDSN = redacted
+	}
+	return c
+}
+
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+type envLoader struct {
+	problems []string
+}
+
+func (l *envLoader) string(key string, dst *string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = v
+	}
+}
+
+// list reads a comma-separated list, ignoring empty items.
+func (l *envLoader) list(key string, dst *[]string) {
+	if v, ok := os.LookupEnv(key); ok {
+		items := []string{}
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*dst = items
+	}
+}
+
+// flags reads name=bool pairs separated by commas, merging them over the
+// values from the config file.
+func (l *envLoader) flags(key string, dst *map[string]bool) {
+	var pairs []string
+	l.list(key, &pairs)
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if !ok || err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s: %q is not a name=bool pair", key, pair))
+			continue
+		}
+		if *dst == nil {
+			*dst = map[string]bool{}
+		}
+		(*dst)[strings.TrimSpace(name)] = enabled
+	}
+}
+
+func (l *envLoader) bool(key string, dst *bool) {
+	if v, ok := os.LookupEnv(key); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s: %q is not a boolean", key, v))
+			return
+		}
+		*dst = b
+	}
+}
+
+func (l *envLoader) int(key string, dst *int) {
+	if v, ok := os.LookupEnv(key); ok {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s: %q is not an integer", key, v))
+			return
+		}
+		*dst = i
+	}
+}
+
+func (l *envLoader) int64(key string, dst *int64) {
+	if v, ok := os.LookupEnv(key); ok {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s: %q is not an integer", key, v))
+			return
+		}
+		*dst = i
+	}
+}
+
+func (l *envLoader) float(key string, dst *float64) {
+	if v, ok := os.LookupEnv(key); ok {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			l.problems = append(l.problems, fmt.Sprintf("%s: %q is not a number", key, v))
+			return
+		}
+		*dst = f
+	}
+}
+
+func (l *envLoader) seconds(key string, dst *time.Duration) {
+	var s int
+	before := len(l.problems)
+	if _, ok := os.LookupEnv(key); !ok {
+		return
+	}
+	l.int(key, &s)
+	if len(l.problems) == before {
+		*dst = time.Duration(s) * time.Second
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/illa-family/builder-backend/internal/feature"
+)
+
+// writeConfigFile points ConfigFileEnv at a temporary file holding content.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	t.Setenv(ConfigFileEnv, path)
+	return path
+}
+
+// loadProblems runs Load and returns the validation problems it reported.
+func loadProblems(t *testing.T) []string {
+	t.Helper()
+	_, err := Load()
+	if err == nil {
+		return nil
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Load() error = %v, want a *ValidationError", err)
+	}
+	return validationErr.Problems
+}
+
+func hasProblem(problems []string, substr string) bool {
+	for _, p := range problems {
+		if strings.Contains(p, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Load() = %+v, want the defaults", cfg)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("PORT", "9000")
+	t.Setenv("ILLA_SHUTDOWN_TIMEOUT_SECONDS", "10")
+	t.Setenv("ILLA_SHUTDOWN_DELAY_SECONDS", "0")
+	t.Setenv("ILLA_TRUSTED_PROXIES", " 10.0.0.0/8, ,192.0.2.1 ")
+	t.Setenv("ILLA_RATE_LIMIT_ENABLED", "true")
+	t.Setenv("ILLA_RATE_LIMIT_AUTH_RATE", "0.5")
+	t.Setenv("ILLA_MAX_BODY_BYTES", "2048")
+	t.Setenv("ILLA_FEATURE_FLAGS", "strict_json_decoding = false")
+	t.Setenv("ILLA_ERROR_REPORTER", "sentry")
+	t.Setenv("ILLA_SENTRY_DSN", "https://key@sentry.example.com/1")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 9000 {
+		t.Errorf("port = %d, want 9000", cfg.Server.Port)
+	}
+	if cfg.Server.ShutdownTimeout != 10*time.Second || cfg.Server.ShutdownDelay != 0 {
+		t.Errorf("shutdown timeout, delay = %v, %v, want 10s, 0s", cfg.Server.ShutdownTimeout, cfg.Server.ShutdownDelay)
+	}
+	if want := []string{"10.0.0.0/8", "192.0.2.1"}; !reflect.DeepEqual(cfg.Server.TrustedProxies, want) {
+		t.Errorf("trusted proxies = %q, want %q", cfg.Server.TrustedProxies, want)
+	}
+	if !cfg.RateLimit.Enabled || cfg.RateLimit.AuthRate != 0.5 {
+		t.Errorf("rate limit = %+v, want enabled with auth rate 0.5", cfg.RateLimit)
+	}
+	if cfg.Request.MaxBodyBytes != 2048 {
+		t.Errorf("max body bytes = %d, want 2048", cfg.Request.MaxBodyBytes)
+	}
+	if want := map[string]bool{"strict_json_decoding": false}; !reflect.DeepEqual(cfg.FeatureFlags, want) {
+		t.Errorf("feature flags = %v, want %v", cfg.FeatureFlags, want)
+	}
+}
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	writeConfigFile(t, "server:\n  port: 7000\n  shutdownTimeout: 15s\n")
+	t.Setenv("ILLA_SERVER_PORT", "7001")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 7001 || cfg.Server.ShutdownTimeout != 15*time.Second {
+		t.Errorf("server = %+v, want port 7001 from the env and timeout 15s from the file", cfg.Server)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		problem string
+	}{
+		{"port range", map[string]string{"PORT": "70000"}, "server port 70000 is out of range"},
+		{"malformed int", map[string]string{"PORT": "http"}, `PORT: "http" is not an integer`},
+		{"malformed bool", map[string]string{"ILLA_METRICS_ENABLED": "yes please"}, "is not a boolean"},
+		{"malformed seconds", map[string]string{"ILLA_SHUTDOWN_TIMEOUT_SECONDS": "1m"}, "is not an integer"},
+		{"zero shutdown timeout", map[string]string{"ILLA_SHUTDOWN_TIMEOUT_SECONDS": "0"}, "shutdown timeout must be positive"},
+		{"negative shutdown delay", map[string]string{"ILLA_SHUTDOWN_DELAY_SECONDS": "-1"}, "shutdown delay must not be negative"},
+		{"trusted proxy", map[string]string{"ILLA_TRUSTED_PROXIES": "proxy.internal"}, `trusted proxy "proxy.internal"`},
+		{"short metrics password", map[string]string{"ILLA_METRICS_USERNAME": "prom", "ILLA_METRICS_PASSWORD": "short"}, "metrics password must be at least 12"},
+		{"short admin password", map[string]string{"ILLA_ADMIN_USERNAME": "admin", "ILLA_ADMIN_PASSWORD": "short"}, "admin password must be at least 12"},
+		{"rate limit rate", map[string]string{"ILLA_RATE_LIMIT_ENABLED": "true", "ILLA_RATE_LIMIT_API_RATE": "0"}, "api rate must be positive"},
+		{"rate limit burst", map[string]string{"ILLA_RATE_LIMIT_ENABLED": "true", "ILLA_RATE_LIMIT_AUTH_BURST": "0"}, "auth burst must be at least 1"},
+		{"unknown reporter", map[string]string{"ILLA_ERROR_REPORTER": "rollbar"}, `unknown error reporter "rollbar"`},
+		{"sentry without dsn", map[string]string{"ILLA_ERROR_REPORTER": "sentry"}, "requires a valid sentry DSN"},
+		{"malformed sentry dsn", map[string]string{"ILLA_ERROR_REPORTER": "sentry", "ILLA_SENTRY_DSN": "not-a-dsn"}, "requires a valid sentry DSN"},
+		{"sentry dsn without key", map[string]string{"ILLA_ERROR_REPORTER": "sentry", "ILLA_SENTRY_DSN": "https://sentry.example.com/1"}, "requires a valid sentry DSN"},
+		{"traces exporter", map[string]string{"OTEL_TRACES_EXPORTER": "jaeger"}, `unsupported traces exporter "jaeger"`},
+		{"body limit", map[string]string{"ILLA_MAX_BODY_BYTES": "0"}, "max request body size must be positive"},
+		{"unknown flag", map[string]string{"ILLA_FEATURE_FLAGS": "no_such_flag=true"}, `unknown feature flag "no_such_flag"`},
+		{"malformed flag", map[string]string{"ILLA_FEATURE_FLAGS": "strict_json_decoding"}, "is not a name=bool pair"},
+		{"cors", map[string]string{"ILLA_CORS_ALLOW_CREDENTIALS": "true"}, "cors: "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if problems := loadProblems(t); !hasProblem(problems, tt.problem) {
+				t.Errorf("problems = %q, want one containing %q", problems, tt.problem)
+			}
+		})
+	}
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	writeConfigFile(t, "server:\n  prot: 9000\nmetrics:\n  enabled: true\n")
+	t.Setenv("ILLA_METRICS_ENABLED", "maybe")
+	t.Setenv("ILLA_MAX_BODY_BYTES", "0")
+
+	problems := loadProblems(t)
+	for _, want := range []string{"line 2: field prot not found", "ILLA_METRICS_ENABLED", "max request body size"} {
+		if !hasProblem(problems, want) {
+			t.Errorf("problems = %q, want one containing %q", problems, want)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		problem string
+	}{
+		{"empty file", "", ""},
+		{"unknown top-level key", "metircs:\n  enabled: true\n", "field metircs not found"},
+		{"unknown nested key", "cors:\n  allowedOrigin: [https://example.com]\n", "field allowedOrigin not found"},
+		{"wrong type", "server:\n  port: eighty\n", "cannot unmarshal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeConfigFile(t, tt.content)
+			problems := loadProblems(t)
+			if tt.problem == "" && len(problems) > 0 {
+				t.Errorf("problems = %q, want none", problems)
+			}
+			if tt.problem != "" && !hasProblem(problems, tt.problem) {
+				t.Errorf("problems = %q, want one containing %q", problems, tt.problem)
+			}
+		})
+	}
+}
+
+func TestLoadMalformedConfigFile(t *testing.T) {
+	writeConfigFile(t, "server: [port\n")
+	_, err := Load()
+	var validationErr *ValidationError
+	if err == nil || errors.As(err, &validationErr) {
+		t.Errorf("Load() error = %v, want a parse error", err)
+	}
+}
+
+func TestAllowUnknownJSONFieldsAlias(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		strict   string
+		warnings int
+	}{
+		{
+			name:   "neither set",
+			strict: "unset",
+		},
+		{
+			name:     "file alias",
+			file:     "request:\n  allowUnknownJSONFields: true\n",
+			strict:   "false",
+			warnings: 1,
+		},
+		{
+			name:     "file flag wins over file alias",
+			file:     "request:\n  allowUnknownJSONFields: true\nfeatureFlags:\n  strict_json_decoding: true\n",
+			strict:   "true",
+			warnings: 1,
+		},
+		{
+			name:     "env alias wins over file flag",
+			file:     "featureFlags:\n  strict_json_decoding: true\n",
+			env:      map[string]string{allowUnknownJSONFieldsEnv: "true"},
+			strict:   "false",
+			warnings: 1,
+		},
+		{
+			name:     "env alias wins over file alias",
+			file:     "request:\n  allowUnknownJSONFields: false\n",
+			env:      map[string]string{allowUnknownJSONFieldsEnv: "true"},
+			strict:   "false",
+			warnings: 2,
+		},
+		{
+			name:     "env flag wins over env alias",
+			env:      map[string]string{allowUnknownJSONFieldsEnv: "true", "ILLA_FEATURE_FLAGS": "strict_json_decoding=true"},
+			strict:   "true",
+			warnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				writeConfigFile(t, tt.file)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			strict := "unset"
+			if enabled, ok := cfg.FeatureFlags["strict_json_decoding"]; ok {
+				strict = strconv.FormatBool(enabled)
+			}
+			if strict != tt.strict {
+				t.Errorf("strict_json_decoding = %s, want %s", strict, tt.strict)
+			}
+			if len(cfg.Warnings) != tt.warnings {
+				t.Errorf("warnings = %q, want %d", cfg.Warnings, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestAllowUnknownJSONFieldsMalformedEnv(t *testing.T) {
+	t.Setenv(allowUnknownJSONFieldsEnv, "sometimes")
+	if problems := loadProblems(t); !hasProblem(problems, allowUnknownJSONFieldsEnv) {
+		t.Errorf("problems = %q, want one naming %s", problems, allowUnknownJSONFieldsEnv)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Metrics.Password = "metrics-password"
+	cfg.Admin.Password = "admin-password"
+	cfg.Reporter.SentryDSN = "https://key@sentry.example.com/1"
+
+	got := cfg.Redacted()
+	for name, value := range map[string]string{
+		"metrics password": got.Metrics.Password,
+		"admin password":   got.Admin.Password,
+		"sentry DSN":       got.Reporter.SentryDSN,
+	} {
+		if value != redacted {
+			t.Errorf("%s = %q, want it masked", name, value)
+		}
+	}
+	if cfg.Admin.Password != "admin-password" {
+		t.Error("Redacted modified the original config")
+	}
+}
+
+func TestFlags(t *testing.T) {
+	cfg := Default()
+	cfg.FeatureFlags = map[string]bool{"strict_json_decoding": false}
+	want := map[feature.Flag]bool{feature.StrictJSONDecoding: false}
+	if got := cfg.Flags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Flags() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+)
+
+const (
+	allowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	exposedHeaders = "X-Request-ID, Retry-After"
+)
+
+type origin struct {
+	scheme string
+	// host is the exact host[:port], or the suffix (".example.com") after
+	// the wildcard for a wildcard-subdomain origin.
+	host     string
+	wildcard bool
+}
+
+// Policy decides which cross-origin callers may use the API, for both plain
+// HTTP requests and the websocket handshake. Same-origin requests and
+// requests without an Origin header are always allowed.
+type Policy struct {
+	origins          []origin
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+// NewPolicy parses allowed origins of the form scheme://host[:port], where
+// the host may start with "*." to allow any subdomain.
+func NewPolicy(allowedOrigins []string, allowCredentials bool, maxAge time.Duration) (*Policy, error) {
+	p := &Policy{
+		allowCredentials: allowCredentials,
+		maxAge:           maxAge,
+	}
+	for _, raw := range allowedOrigins {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid allowed origin %q: expected scheme://host[:port]", raw)
+		}
+		o := origin{scheme: u.Scheme, host: strings.ToLower(u.Host)}
+		if strings.HasPrefix(o.host, "*.") {
+			o.host = o.host[1:]
+			o.wildcard = true
+		}
+		if strings.Contains(o.host, "*") {
+			return nil, fmt.Errorf("invalid allowed origin %q: only a leading \"*.\" wildcard is supported", raw)
+		}
+		p.origins = append(p.origins, o)
+	}
+	if allowCredentials && len(p.origins) == 0 {
+		return nil, fmt.Errorf("allowing credentials requires at least one allowed origin")
+	}
+	return p, nil
+}
+
+func (p *Policy) allowed(rawOrigin string) bool {
+	u, err := url.Parse(rawOrigin)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	for _, o := range p.origins {
+		if o.scheme != u.Scheme {
+			continue
+		}
+		if o.wildcard && strings.HasSuffix(host, o.host) && len(host) > len(o.host) {
+			return true
+		}
+		if !o.wildcard && o.host == host {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin compares the scheme and host of rawOrigin with those r was sent
+// to, so a plaintext page can't pass as the TLS origin of the same host.
+func sameOrigin(r *http.Request, rawOrigin string) bool {
+	u, err := url.Parse(rawOrigin)
+	return err == nil && u.Scheme == requestScheme(r) && strings.EqualFold(u.Host, r.Host)
+}
+
+// requestScheme is the scheme the client used. Behind a TLS-terminating
+// proxy it comes from X-Forwarded-Proto; a browser page can't set that header
+// on a websocket handshake, and setting it on fetch forces a preflight, which
+// is checked without it.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ","); proto != "" {
+		return strings.ToLower(strings.TrimSpace(proto))
+	}
+	return "http"
+}
+
+// CheckOrigin reports whether r may proceed; it fits websocket.Upgrader.
+func (p *Policy) CheckOrigin(r *http.Request) bool {
+	o := r.Header.Get("Origin")
+	return o == "" || sameOrigin(r, o) || p.allowed(o)
+}
+
+// Middleware answers preflight requests, adds CORS headers for allowed
+// cross-origin callers and rejects the others with 403.
+func (p *Policy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		o := c.GetHeader("Origin")
+		if o == "" || sameOrigin(c.Request, o) {
+			c.Next()
+			return
+		}
+		if !p.allowed(o) {
+			api.AbortWithError(c, http.StatusForbidden, api.ErrorResponse{
+				ErrorCode:   api.ErrorCodeOriginNotAllowed,
+				ErrorDetail: fmt.Sprintf("origin %s is not allowed", o),
+			})
+			return
+		}
+		h := c.Writer.Header()
+		h.Set("Access-Control-Allow-Origin", o)
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Expose-Headers", exposedHeaders)
+		if p.allowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", allowedMethods)
+			if requested := c.GetHeader("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+			if p.maxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
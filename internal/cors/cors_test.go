@@ -0,0 +1,206 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cors
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+)
+
+func newTestPolicy(t *testing.T, allowCredentials bool) *Policy {
+	t.Helper()
+	p, err := NewPolicy([]string{"http://localhost:3000", "https://*.example.com"}, allowCredentials, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	return p
+}
+
+func newTestRouter(p *Policy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(p.Middleware())
+	r.Any("/apps", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func TestMiddlewareOrigins(t *testing.T) {
+	r := newTestRouter(newTestPolicy(t, false))
+	tests := []struct {
+		name    string
+		origin  string
+		tls     bool
+		proto   string
+		status  int
+		allowed bool
+	}{
+		{name: "no origin", status: http.StatusOK},
+		{name: "exact origin", origin: "http://localhost:3000", status: http.StatusOK, allowed: true},
+		{name: "other port", origin: "http://localhost:3001", status: http.StatusForbidden},
+		{name: "missing port", origin: "http://localhost", status: http.StatusForbidden},
+		{name: "exact origin with other scheme", origin: "https://localhost:3000", status: http.StatusForbidden},
+		{name: "subdomain", origin: "https://app.example.com", status: http.StatusOK, allowed: true},
+		{name: "nested subdomain", origin: "https://a.b.example.com", status: http.StatusOK, allowed: true},
+		{name: "subdomain case", origin: "https://APP.Example.com", status: http.StatusOK, allowed: true},
+		{name: "subdomain with other scheme", origin: "http://app.example.com", status: http.StatusForbidden},
+		{name: "subdomain with port", origin: "https://app.example.com:8443", status: http.StatusForbidden},
+		{name: "wildcard parent", origin: "https://example.com", status: http.StatusForbidden},
+		{name: "suffix without dot", origin: "https://evilexample.com", status: http.StatusForbidden},
+		{name: "allowed host as prefix", origin: "https://app.example.com.evil.net", status: http.StatusForbidden},
+		{name: "same origin", origin: "http://api.example.net", status: http.StatusOK},
+		{name: "same origin over tls", origin: "https://api.example.net", tls: true, status: http.StatusOK},
+		{name: "same origin behind tls proxy", origin: "https://api.example.net", proto: "https", status: http.StatusOK},
+		{name: "plaintext page for tls backend", origin: "http://api.example.net", tls: true, status: http.StatusForbidden},
+		{name: "plaintext page behind tls proxy", origin: "http://api.example.net", proto: "https", status: http.StatusForbidden},
+		{name: "tls page for plaintext backend", origin: "https://api.example.net", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://api.example.net/apps", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			acao := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.allowed && acao != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", acao, tt.origin)
+			}
+			if !tt.allowed && acao != "" {
+				t.Errorf("Access-Control-Allow-Origin = %q, want none", acao)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRejectionBody(t *testing.T) {
+	r := newTestRouter(newTestPolicy(t, false))
+	req := httptest.NewRequest(http.MethodPost, "/apps", nil)
+	req.Header.Set("Origin", "https://evilexample.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403", w.Code)
+	}
+	var resp api.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body %q: %v", w.Body, err)
+	}
+	if resp.ErrorCode != api.ErrorCodeOriginNotAllowed || resp.ErrorDetail != "origin https://evilexample.com is not allowed" || resp.ErrorMessage == "" {
+		t.Errorf("body = %+v, want an ORIGIN_NOT_ALLOWED error naming the origin", resp)
+	}
+}
+
+func TestMiddlewarePreflight(t *testing.T) {
+	r := newTestRouter(newTestPolicy(t, true))
+	req := httptest.NewRequest(http.MethodOptions, "/apps", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	req.Header.Set("Access-Control-Request-Headers", "content-type, x-request-id")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", w.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Methods":     allowedMethods,
+		"Access-Control-Allow-Headers":     "content-type, x-request-id",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+		"Access-Control-Expose-Headers":    exposedHeaders,
+		"Vary":                             "Origin",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestMiddlewareWithoutCredentials(t *testing.T) {
+	r := newTestRouter(newTestPolicy(t, false))
+	req := httptest.NewRequest(http.MethodGet, "/apps", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want none", got)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	p := newTestPolicy(t, false)
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"https://api.example.net", true},
+		{"http://api.example.net", false},
+		{"https://app.example.com", true},
+		{"https://evilexample.com", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "https://api.example.net/realtime/ping", nil)
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		if got := p.CheckOrigin(req); got != tt.want {
+			t.Errorf("CheckOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestNewPolicyRejects(t *testing.T) {
+	tests := []struct {
+		name             string
+		origins          []string
+		allowCredentials bool
+	}{
+		{"credentials without origins", nil, true},
+		{"missing scheme", []string{"example.com"}, false},
+		{"unsupported scheme", []string{"ftp://example.com"}, false},
+		{"path", []string{"https://example.com/app"}, false},
+		{"inner wildcard", []string{"https://app.*.example.com"}, false},
+		{"bare wildcard", []string{"*"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPolicy(tt.origins, tt.allowCredentials, 0); err == nil {
+				t.Errorf("NewPolicy(%q, %v) succeeded, want an error", tt.origins, tt.allowCredentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feature
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/illa-family/builder-backend/internal/logger"
+	"go.uber.org/zap"
+)
+
+// Flag names a feature flag. Its field is unexported, so the variables below
+// and the results of Lookup are the only flags that exist and a misspelled
+// flag fails to compile.
+type Flag struct {
+	name string
+}
+
+func (f Flag) String() string {
+	return f.name
+}
+
+// MarshalText encodes the flag as its name, also when used as a map key.
+func (f Flag) MarshalText() ([]byte, error) {
+	return []byte(f.name), nil
+}
+
+// Every flag must be declared here and described in definitions.
+var (
+	StrictJSONDecoding = Flag{"strict_json_decoding"}
+)
+
+type Definition struct {
+	Default     bool
+	Description string
+}
+
+var definitions = map[Flag]Definition{
+	StrictJSONDecoding: {
+		Default:     true,
+		Description: "Reject request bodies containing fields the endpoint does not declare.",
+	},
+}
+
+// Lookup resolves a flag by name, for parsing configuration and stored
+// overrides.
+func Lookup(name string) (Flag, bool) {
+	if _, ok := definitions[Flag{name}]; !ok {
+		return Flag{}, false
+	}
+	return Flag{name}, true
+}
+
+// TeamOverrideStore loads the per-team overrides, typically from the
+// database.
+type TeamOverrideStore interface {
+	TeamOverrides(ctx context.Context, teamID int) (map[Flag]bool, error)
+}
+
+const teamCacheTTL = 30 * time.Second
+
+type teamEntry struct {
+	overrides map[Flag]bool
+	loadedAt  time.Time
+}
+
+// Service evaluates flags: a team override wins over an instance override,
+// which wins over the default. Team overrides are cached so evaluation
+// doesn't hit the store on every request.
+type Service struct {
+	instance map[Flag]bool
+	teams    TeamOverrideStore
+	now      func() time.Time
+
+	mu        sync.Mutex
+	teamCache map[int]teamEntry
+}
+
+// NewService returns a Service; teams may be nil when no team overrides exist.
+func NewService(instance map[Flag]bool, teams TeamOverrideStore) *Service {
+	return &Service{
+		instance:  instance,
+		teams:     teams,
+		now:       time.Now,
+		teamCache: make(map[int]teamEntry),
+	}
+}
+
+type teamIDKey struct{}
+
+// WithTeamID scopes flag evaluation in ctx to a team.
+func WithTeamID(ctx context.Context, teamID int) context.Context {
+	return context.WithValue(ctx, teamIDKey{}, teamID)
+}
+
+// Enabled reports whether flag is on for ctx. The zero Flag is logged and
+// reported off; feature_test.go keeps the declared flags defined.
+func (s *Service) Enabled(ctx context.Context, flag Flag) bool {
+	def, ok := definitions[flag]
+	if !ok {
+		logger.FromContext(ctx).Error("undefined feature flag", zap.Stringer("flag", flag))
+		return false
+	}
+	if teamID, ok := ctx.Value(teamIDKey{}).(int); ok {
+		if v, ok := s.teamOverrides(ctx, teamID)[flag]; ok {
+			return v
+		}
+	}
+	if v, ok := s.instance[flag]; ok {
+		return v
+	}
+	return def.Default
+}
+
+// teamOverrides returns the cached overrides of a team. When the store
+// fails, the stale entry (or none) is used rather than failing the request.
+func (s *Service) teamOverrides(ctx context.Context, teamID int) map[Flag]bool {
+	if s.teams == nil {
+		return nil
+	}
+	s.mu.Lock()
+	entry, ok := s.teamCache[teamID]
+	s.mu.Unlock()
+	if ok && s.now().Sub(entry.loadedAt) < teamCacheTTL {
+		return entry.overrides
+	}
+	overrides, err := s.teams.TeamOverrides(ctx, teamID)
+	if err != nil {
+		return entry.overrides
+	}
+	s.mu.Lock()
+	s.teamCache[teamID] = teamEntry{overrides: overrides, loadedAt: s.now()}
+	s.mu.Unlock()
+	return overrides
+}
+
+// InvalidateTeam drops the cached overrides of a team after they change.
+func (s *Service) InvalidateTeam(teamID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.teamCache, teamID)
+}
+
+type State struct {
+	Flag        Flag   `json:"flag"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// List reports every flag with its effective value for ctx.
+func (s *Service) List(ctx context.Context) []State {
+	states := make([]State, 0, len(definitions))
+	for flag, def := range definitions {
+		states = append(states, State{
+			Flag:        flag,
+			Description: def.Description,
+			Default:     def.Default,
+			Enabled:     s.Enabled(ctx, flag),
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Flag.name < states[j].Flag.name })
+	return states
+}
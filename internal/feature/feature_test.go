@@ -0,0 +1,159 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feature
+
+import (
+	"context"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEveryFlagIsDefined parses the package for Flag literals. Other packages
+// can't construct a Flag, so a flag declared here without a definitions
+// entry is the only way to reach an undefined one.
+func TestEveryFlagIsDefined(t *testing.T) {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, pkg := range pkgs {
+		for name, f := range pkg.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				lit, ok := n.(*ast.CompositeLit)
+				if !ok {
+					return true
+				}
+				if id, ok := lit.Type.(*ast.Ident); !ok || id.Name != "Flag" || len(lit.Elts) != 1 {
+					return true
+				}
+				value, ok := lit.Elts[0].(*ast.BasicLit)
+				if !ok {
+					return true
+				}
+				flagName, _ := strconv.Unquote(value.Value)
+				found++
+				if _, ok := definitions[Flag{flagName}]; !ok {
+					t.Errorf("%s: flag %q has no definitions entry", name, flagName)
+				}
+				return true
+			})
+		}
+	}
+	if found == 0 {
+		t.Fatal("found no Flag literals; the scan is broken")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if flag, ok := Lookup("strict_json_decoding"); !ok || flag != StrictJSONDecoding {
+		t.Errorf("Lookup(strict_json_decoding) = %v, %v, want the declared flag", flag, ok)
+	}
+	if flag, ok := Lookup("strcit_json_decoding"); ok || flag != (Flag{}) {
+		t.Errorf("Lookup(strcit_json_decoding) = %v, %v, want the zero Flag", flag, ok)
+	}
+}
+
+func TestUndefinedFlagIsOff(t *testing.T) {
+	s := NewService(map[Flag]bool{{}: true}, nil)
+	if s.Enabled(context.Background(), Flag{}) {
+		t.Error("zero flag reported enabled")
+	}
+}
+
+func TestListEncodesFlagNames(t *testing.T) {
+	raw, err := json.Marshal(NewService(nil, nil).List(context.Background()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"flag":"strict_json_decoding"`) {
+		t.Errorf("List encoded as %s, want flag names", raw)
+	}
+}
+
+type fakeTeamStore struct {
+	overrides map[int]map[Flag]bool
+	loads     int
+}
+
+func (s *fakeTeamStore) TeamOverrides(_ context.Context, teamID int) (map[Flag]bool, error) {
+	s.loads++
+	return s.overrides[teamID], nil
+}
+
+func TestPrecedence(t *testing.T) {
+	def := definitions[StrictJSONDecoding].Default
+	teams := &fakeTeamStore{overrides: map[int]map[Flag]bool{
+		1: {StrictJSONDecoding: def},
+	}}
+	tests := []struct {
+		name     string
+		instance map[Flag]bool
+		teamID   int
+		want     bool
+	}{
+		{"default", nil, 0, def},
+		{"instance over default", map[Flag]bool{StrictJSONDecoding: !def}, 0, !def},
+		{"team over instance", map[Flag]bool{StrictJSONDecoding: !def}, 1, def},
+		{"team without override", map[Flag]bool{StrictJSONDecoding: !def}, 2, !def},
+	}
+	for _, tt := range tests {
+		s := NewService(tt.instance, teams)
+		ctx := context.Background()
+		if tt.teamID != 0 {
+			ctx = WithTeamID(ctx, tt.teamID)
+		}
+		if got := s.Enabled(ctx, StrictJSONDecoding); got != tt.want {
+			t.Errorf("%s: Enabled = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTeamOverridesAreCached(t *testing.T) {
+	teams := &fakeTeamStore{overrides: map[int]map[Flag]bool{
+		1: {StrictJSONDecoding: false},
+	}}
+	s := NewService(nil, teams)
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	ctx := WithTeamID(context.Background(), 1)
+
+	s.Enabled(ctx, StrictJSONDecoding)
+	teams.overrides[1] = map[Flag]bool{StrictJSONDecoding: true}
+	now = now.Add(teamCacheTTL - time.Second)
+	if s.Enabled(ctx, StrictJSONDecoding) || teams.loads != 1 {
+		t.Fatalf("override reloaded within the TTL (loads = %d)", teams.loads)
+	}
+
+	now = now.Add(time.Second)
+	if !s.Enabled(ctx, StrictJSONDecoding) || teams.loads != 2 {
+		t.Fatalf("override not reloaded after the TTL (loads = %d)", teams.loads)
+	}
+
+	teams.overrides[1] = map[Flag]bool{StrictJSONDecoding: false}
+	s.InvalidateTeam(1)
+	if s.Enabled(ctx, StrictJSONDecoding) || teams.loads != 3 {
+		t.Fatalf("override not reloaded after InvalidateTeam (loads = %d)", teams.loads)
+	}
+}
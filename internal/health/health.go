@@ -0,0 +1,214 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultCheckTimeout = 2 * time.Second
+	DefaultCacheTTL     = 2 * time.Second
+)
+
+// ShuttingDown is reported as the failing dependency once shutdown has begun.
+const ShuttingDown = "shutdown"
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// Check reports whether a dependency is reachable. It must honor ctx.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name     string
+	check    Check
+	optional bool
+}
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+type DependencyStatus struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Optional bool   `json:"optional,omitempty"`
+	Latency  string `json:"latency"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ReadinessReport is the outcome of every registered check. Failing optional
+// checks are reported but don't make the instance unready.
+type ReadinessReport struct {
+	Ready        bool               `json:"ready"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+	CheckedAt    time.Time          `json:"checkedAt"`
+}
+
+// FirstFailure returns the first failing required dependency, if any.
+func (r ReadinessReport) FirstFailure() (DependencyStatus, bool) {
+	for _, dep := range r.Dependencies {
+		if dep.Status == StatusDown && !dep.Optional {
+			return dep, true
+		}
+	}
+	return DependencyStatus{}, false
+}
+
+// Checker runs the registered dependency checks for the readiness probe and
+// caches the report briefly so probe storms don't hammer the dependencies.
+type Checker struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	shuttingDown int32
+
+	mu     sync.Mutex
+	checks []namedCheck
+	infos  map[string]func(ctx context.Context) interface{}
+
+	reportMu sync.Mutex
+	cached   ReadinessReport
+}
+
+func NewChecker(timeout, cacheTTL time.Duration) *Checker {
+	return &Checker{
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// Register adds a dependency the instance can't serve requests without.
+func (c *Checker) Register(name string, check Check) {
+	c.register(namedCheck{name: name, check: check})
+}
+
+// RegisterOptional adds a dependency, such as a sample of user resources,
+// whose failure is reported without making the instance unready.
+func (c *Checker) RegisterOptional(name string, check Check) {
+	c.register(namedCheck{name: name, check: check, optional: true})
+}
+
+func (c *Checker) register(nc namedCheck) {
+	c.mu.Lock()
+	c.checks = append(c.checks, nc)
+	c.mu.Unlock()
+	c.reportMu.Lock()
+	c.cached = ReadinessReport{}
+	c.reportMu.Unlock()
+}
+
+// RegisterInfo adds a field to the readiness response which describes the
+// instance without affecting readiness, e.g. whether maintenance mode is on.
+func (c *Checker) RegisterInfo(name string, info func(ctx context.Context) interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.infos == nil {
+		c.infos = make(map[string]func(ctx context.Context) interface{})
+	}
+	c.infos[name] = info
+}
+
+func (c *Checker) Info(ctx context.Context) map[string]interface{} {
+	c.mu.Lock()
+	infos := make(map[string]func(ctx context.Context) interface{}, len(c.infos))
+	for name, info := range c.infos {
+		infos[name] = info
+	}
+	c.mu.Unlock()
+	values := make(map[string]interface{}, len(infos))
+	for name, info := range infos {
+		values[name] = info(ctx)
+	}
+	return values
+}
+
+// SetShuttingDown makes every following readiness check fail, so the load
+// balancer stops routing to this instance before connections are drained.
+func (c *Checker) SetShuttingDown() {
+	atomic.StoreInt32(&c.shuttingDown, 1)
+}
+
+// SystemReadiness reports the status of every dependency. The error names the
+// first failing required dependency, or the shutdown in progress. It takes no
+// context: the report is cached for every caller, so one probe giving up
+// must not turn into a "down" report for the whole TTL.
+func (c *Checker) SystemReadiness() (ReadinessReport, error) {
+	if atomic.LoadInt32(&c.shuttingDown) == 1 {
+		return ReadinessReport{
+			Dependencies: []DependencyStatus{{Name: ShuttingDown, Status: StatusDown, Error: errShuttingDown.Error()}},
+			CheckedAt:    time.Now(),
+		}, errShuttingDown
+	}
+
+	c.reportMu.Lock()
+	defer c.reportMu.Unlock()
+	if c.cached.CheckedAt.IsZero() || time.Since(c.cached.CheckedAt) >= c.cacheTTL {
+		c.cached = c.run()
+	}
+	// Copy the dependencies so callers can't change what later probes see.
+	report := c.cached
+	report.Dependencies = append([]DependencyStatus(nil), c.cached.Dependencies...)
+	if dep, failed := report.FirstFailure(); failed {
+		return report, fmt.Errorf("%s: %s", dep.Name, dep.Error)
+	}
+	return report, nil
+}
+
+// run executes the checks concurrently, so the probe takes as long as the
+// slowest check rather than their sum.
+func (c *Checker) run() ReadinessReport {
+	c.mu.Lock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.Unlock()
+
+	report := ReadinessReport{
+		Ready:        true,
+		Dependencies: make([]DependencyStatus, len(checks)),
+	}
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, nc namedCheck) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(context.Background(), c.timeout)
+			defer cancel()
+			start := time.Now()
+			err := nc.check(checkCtx)
+			dep := DependencyStatus{
+				Name:     nc.name,
+				Status:   StatusUp,
+				Optional: nc.optional,
+				Latency:  time.Since(start).String(),
+			}
+			if err != nil {
+				dep.Status = StatusDown
+				dep.Error = err.Error()
+			}
+			report.Dependencies[i] = dep
+		}(i, nc)
+	}
+	wg.Wait()
+	_, failed := report.FirstFailure()
+	report.Ready = !failed
+	report.CheckedAt = time.Now()
+	return report
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowCheck waits for d unless its context ends first.
+func slowCheck(d time.Duration) Check {
+	return func(ctx context.Context) error {
+		select {
+		case <-time.After(d):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestReportIsACopy(t *testing.T) {
+	c := NewChecker(time.Second, time.Minute)
+	c.Register("database", func(context.Context) error { return nil })
+	report, err := c.SystemReadiness()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.Dependencies[0].Status = StatusDown
+
+	report, err = c.SystemReadiness()
+	if err != nil || report.Dependencies[0].Status != StatusUp {
+		t.Fatalf("next probe: status=%s err=%v, want the cached report unchanged", report.Dependencies[0].Status, err)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	c := NewChecker(10*time.Millisecond, time.Minute)
+	c.Register("database", slowCheck(time.Second))
+	report, err := c.SystemReadiness()
+	if err == nil || report.Ready {
+		t.Fatal("a check exceeding the timeout was reported up")
+	}
+	if dep, _ := report.FirstFailure(); dep.Name != "database" || dep.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("first failure = %+v", dep)
+	}
+}
+
+func TestReportIsCached(t *testing.T) {
+	c := NewChecker(time.Second, 50*time.Millisecond)
+	var calls int32
+	c.Register("database", func(context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		_, _ = c.SystemReadiness()
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("check ran %d times within the TTL, want 1", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	_, _ = c.SystemReadiness()
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("check ran %d times after the TTL, want 2", n)
+	}
+}
+
+func TestOptionalFailureKeepsReady(t *testing.T) {
+	c := NewChecker(time.Second, time.Minute)
+	c.Register("database", func(context.Context) error { return nil })
+	c.RegisterOptional("resource sample", func(context.Context) error { return errors.New("unreachable") })
+	report, err := c.SystemReadiness()
+	if err != nil || !report.Ready {
+		t.Fatalf("ready=%v err=%v, want ready", report.Ready, err)
+	}
+	if dep := report.Dependencies[1]; dep.Status != StatusDown || !dep.Optional {
+		t.Errorf("optional dependency = %+v, want down and optional", dep)
+	}
+}
+
+func TestShuttingDown(t *testing.T) {
+	c := NewChecker(time.Second, time.Minute)
+	c.Register("database", func(context.Context) error { return nil })
+	if _, err := c.SystemReadiness(); err != nil {
+		t.Fatal(err)
+	}
+	c.SetShuttingDown()
+	report, err := c.SystemReadiness()
+	if err == nil || report.Ready {
+		t.Fatal("ready while shutting down")
+	}
+	if dep, _ := report.FirstFailure(); dep.Name != ShuttingDown {
+		t.Errorf("first failure = %q, want %q", dep.Name, ShuttingDown)
+	}
+}
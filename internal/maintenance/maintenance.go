@@ -0,0 +1,148 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/reporter"
+)
+
+// ErrMaintenanceMode is a 503, but maintenance is a normal operating state,
+// so it is registered as expected and never sent to the error reporter.
+var ErrMaintenanceMode = &api.Error{
+	Code:   api.ErrorCodeMaintenanceMode,
+	Status: http.StatusServiceUnavailable,
+	Detail: "the instance is in maintenance mode and read-only",
+}
+
+func init() {
+	reporter.RegisterExpected(ErrMaintenanceMode)
+}
+
+// Store holds the switch. A store shared between replicas (e.g. a database
+// row) makes a toggle on one instance reach all of them within the cache TTL.
+type Store interface {
+	Get(ctx context.Context) (bool, error)
+	Set(ctx context.Context, enabled bool) error
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	enabled bool
+}
+
+func NewMemoryStore(enabled bool) Store {
+	return &memoryStore{enabled: enabled}
+}
+
+func (s *memoryStore) Get(context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enabled, nil
+}
+
+func (s *memoryStore) Set(_ context.Context, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enabled = enabled
+	return nil
+}
+
+const DefaultCacheTTL = 5 * time.Second
+
+// Switch caches the store briefly so checking it on every mutating request
+// stays cheap, and notifies listeners whenever the observed state changes.
+type Switch struct {
+	store    Store
+	cacheTTL time.Duration
+
+	mu        sync.Mutex
+	enabled   bool
+	checkedAt time.Time
+	listeners []func(enabled bool)
+}
+
+func NewSwitch(store Store, cacheTTL time.Duration) *Switch {
+	return &Switch{
+		store:    store,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// OnChange registers fn to run after the state changes, including changes
+// made by other replicas.
+func (s *Switch) OnChange(fn func(enabled bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// Enabled reports the cached state; when the store can't be read the last
+// known state is kept.
+func (s *Switch) Enabled(ctx context.Context) bool {
+	s.mu.Lock()
+	if !s.checkedAt.IsZero() && time.Since(s.checkedAt) < s.cacheTTL {
+		defer s.mu.Unlock()
+		return s.enabled
+	}
+	s.mu.Unlock()
+
+	enabled, err := s.store.Get(ctx)
+	if err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.enabled
+	}
+	s.observe(enabled)
+	return enabled
+}
+
+func (s *Switch) Set(ctx context.Context, enabled bool) error {
+	// Load the current state first so the change is detected and announced.
+	s.Enabled(ctx)
+	if err := s.store.Set(ctx, enabled); err != nil {
+		return err
+	}
+	s.observe(enabled)
+	return nil
+}
+
+// Check returns ErrMaintenanceMode while maintenance is on. Mutating service
+// methods call it before writing.
+func (s *Switch) Check(ctx context.Context) error {
+	if s.Enabled(ctx) {
+		return ErrMaintenanceMode
+	}
+	return nil
+}
+
+func (s *Switch) observe(enabled bool) {
+	s.mu.Lock()
+	changed := !s.checkedAt.IsZero() && s.enabled != enabled
+	s.enabled = enabled
+	s.checkedAt = time.Now()
+	listeners := s.listeners
+	s.mu.Unlock()
+	if changed {
+		for _, fn := range listeners {
+			fn(enabled)
+		}
+	}
+}
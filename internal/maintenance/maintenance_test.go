@@ -0,0 +1,54 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/illa-family/builder-backend/internal/reporter"
+)
+
+func TestErrMaintenanceModeIsExpected(t *testing.T) {
+	if !reporter.IsExpected(ErrMaintenanceMode) {
+		t.Error("ErrMaintenanceMode is reported as unexpected")
+	}
+	if err := fmt.Errorf("update app: %w", ErrMaintenanceMode); !reporter.IsExpected(err) {
+		t.Error("wrapped ErrMaintenanceMode is reported as unexpected")
+	}
+}
+
+func TestSwitchCheck(t *testing.T) {
+	s := NewSwitch(NewMemoryStore(false), time.Minute)
+	var changes []bool
+	s.OnChange(func(enabled bool) { changes = append(changes, enabled) })
+
+	ctx := context.Background()
+	if err := s.Check(ctx); err != nil {
+		t.Fatalf("Check() = %v with maintenance off", err)
+	}
+	if err := s.Set(ctx, true); err != nil {
+		t.Fatalf("Set(true) = %v", err)
+	}
+	if err := s.Check(ctx); !errors.Is(err, ErrMaintenanceMode) {
+		t.Errorf("Check() = %v with maintenance on, want ErrMaintenanceMode", err)
+	}
+	if len(changes) != 1 || !changes[0] {
+		t.Errorf("OnChange saw %v, want [true]", changes)
+	}
+}
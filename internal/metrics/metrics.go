@@ -0,0 +1,121 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "illa_builder"
+
+// unmatchedRoute is used as the route label for requests that did not match
+// any registered route, so unknown paths can't blow up label cardinality.
+const unmatchedRoute = "unmatched"
+
+type HTTPMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+func NewHTTPMetrics(reg prometheus.Registerer) *HTTPMetrics {
+	m := &HTTPMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Total number of HTTP requests by route template, method and status code.",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route template and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Number of HTTP requests currently being served.",
+		}),
+	}
+	reg.MustRegister(m.requests, m.duration, m.inFlight)
+	return m
+}
+
+// Middleware records request metrics labelled by the matched route template
+// (e.g. /apps/:id), never by the raw request path.
+func (m *HTTPMetrics) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+		method := c.Request.Method
+		m.requests.WithLabelValues(route, method, strconv.Itoa(c.Writer.Status())).Inc()
+		m.duration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	}
+}
+
+type WebsocketMetrics struct {
+	connections prometheus.Gauge
+	messages    *prometheus.CounterVec
+}
+
+func NewWebsocketMetrics(reg prometheus.Registerer) *WebsocketMetrics {
+	m := &WebsocketMetrics{
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "websocket",
+			Name:      "connections",
+			Help:      "Number of currently open websocket connections.",
+		}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "websocket",
+			Name:      "messages_total",
+			Help:      "Total number of websocket messages by direction.",
+		}, []string{"direction"}),
+	}
+	reg.MustRegister(m.connections, m.messages)
+	return m
+}
+
+func (m *WebsocketMetrics) ConnectionOpened() {
+	m.connections.Inc()
+}
+
+func (m *WebsocketMetrics) ConnectionClosed() {
+	m.connections.Dec()
+}
+
+func (m *WebsocketMetrics) MessageReceived() {
+	m.messages.WithLabelValues("in").Inc()
+}
+
+func (m *WebsocketMetrics) MessageSent() {
+	m.messages.WithLabelValues("out").Inc()
+}
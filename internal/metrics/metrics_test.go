@@ -0,0 +1,76 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRequestsAreLabelledByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reg := prometheus.NewRegistry()
+	m := NewHTTPMetrics(reg)
+	r := gin.New()
+	r.Use(m.Middleware())
+	r.GET("/apps/:appID", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/apps/1", "/apps/2", "/no/such/path"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	want := `
+# HELP illa_builder_http_requests_total Total number of HTTP requests by route template, method and status code.
+# TYPE illa_builder_http_requests_total counter
+illa_builder_http_requests_total{code="200",method="GET",route="/apps/:appID"} 2
+illa_builder_http_requests_total{code="404",method="GET",route="unmatched"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "illa_builder_http_requests_total"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(m.duration); n != 2 {
+		t.Errorf("duration series = %d, want 2 (one per route template)", n)
+	}
+	if v := testutil.ToFloat64(m.inFlight); v != 0 {
+		t.Errorf("in-flight = %v after all requests finished, want 0", v)
+	}
+}
+
+func TestWebsocketMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewWebsocketMetrics(reg)
+	m.ConnectionOpened()
+	m.ConnectionOpened()
+	m.ConnectionClosed()
+	m.MessageReceived()
+	m.MessageSent()
+	m.MessageSent()
+
+	if v := testutil.ToFloat64(m.connections); v != 1 {
+		t.Errorf("connections = %v, want 1", v)
+	}
+	if v := testutil.ToFloat64(m.messages.WithLabelValues("in")); v != 1 {
+		t.Errorf("messages in = %v, want 1", v)
+	}
+	if v := testutil.ToFloat64(m.messages.WithLabelValues("out")); v != 2 {
+		t.Errorf("messages out = %v, want 2", v)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"io"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+)
+
+// BodyLimit caps the request body at maxBytes. A BodyLimit on a route group
+// replaces the one installed on the engine rather than stacking on it, so a
+// group can raise the default as well as lower it. Reads fail with
+// api.ErrBodyTooLarge once past the limit, or right away if the declared
+// Content-Length exceeds it.
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if body, ok := c.Request.Body.(*limitedBody); ok {
+			body.limit = maxBytes
+		} else if c.Request.Body != nil {
+			c.Request.Body = &limitedBody{
+				ReadCloser: c.Request.Body,
+				limit:      maxBytes,
+				declared:   c.Request.ContentLength,
+			}
+		}
+		c.Next()
+	}
+}
+
+// limitedBody checks the limit on every read, since the limit may be
+// replaced after wrapping but before the handler reads the body.
+type limitedBody struct {
+	io.ReadCloser
+	limit    int64
+	declared int64
+	read     int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.declared > b.limit || b.read > b.limit {
+		return 0, api.ErrBodyTooLarge
+	}
+	// Read one byte past the limit so a body of exactly limit bytes passes.
+	if remaining := b.limit - b.read; int64(len(p)) > remaining+1 {
+		p = p[:remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return n - int(b.read-b.limit), api.ErrBodyTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,86 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+)
+
+// newBodyLimitedEngine serves POST /default under an 8 byte engine-wide
+// limit, and /import and /auth with group limits that raise and lower it.
+// Each route answers 200 with the body, or 413 if reading it failed.
+func newBodyLimitedEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(BodyLimit(8))
+	echo := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if errors.Is(err, api.ErrBodyTooLarge) {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	}
+	r.POST("/default", echo)
+	r.Group("/import", BodyLimit(16)).POST("", echo)
+	r.Group("/auth", BodyLimit(4)).POST("", echo)
+	return r
+}
+
+func post(r *gin.Engine, path, body string, chunked bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if chunked {
+		req.ContentLength = -1
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBodyLimit(t *testing.T) {
+	r := newBodyLimitedEngine()
+	tests := []struct {
+		path string
+		size int
+		want int
+	}{
+		{"/default", 8, http.StatusOK},
+		{"/default", 9, http.StatusRequestEntityTooLarge},
+		{"/import", 16, http.StatusOK},
+		{"/import", 17, http.StatusRequestEntityTooLarge},
+		{"/auth", 4, http.StatusOK},
+		{"/auth", 5, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		for _, chunked := range []bool{false, true} {
+			body := strings.Repeat("x", tt.size)
+			w := post(r, tt.path, body, chunked)
+			if w.Code != tt.want {
+				t.Errorf("%s with %d bytes (chunked=%v): status = %d, want %d", tt.path, tt.size, chunked, w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != body {
+				t.Errorf("%s with %d bytes (chunked=%v): body was truncated to %d bytes", tt.path, tt.size, chunked, w.Body.Len())
+			}
+		}
+	}
+}
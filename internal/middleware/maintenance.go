@@ -0,0 +1,49 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/maintenance"
+)
+
+// ReadOnlyDuringMaintenance rejects mutating requests while maintenance mode
+// is on. The exempt route templates (the maintenance switch itself) stay
+// writable.
+func ReadOnlyDuringMaintenance(sw *maintenance.Switch, exempt ...string) gin.HandlerFunc {
+	exemptRoutes := make(map[string]struct{}, len(exempt))
+	for _, route := range exempt {
+		exemptRoutes[route] = struct{}{}
+	}
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if _, ok := exemptRoutes[c.FullPath()]; ok {
+			c.Next()
+			return
+		}
+		if err := sw.Check(c.Request.Context()); err != nil {
+			api.AbortWithTypedError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/logger"
+	"github.com/illa-family/builder-backend/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// UserIDKey is the gin context key under which authentication stores the
+// authenticated user's ID.
+const UserIDKey = "userID"
+
+// RateLimit limits requests per authenticated user, or per client IP for
+// anonymous requests, within the named bucket. It is mounted on route groups
+// rather than the engine: after the group's authentication middleware to
+// limit per user, or before it to throttle credential guessing per IP. If
+// the store fails the request is let through rather than turning a store
+// outage into downtime.
+func RateLimit(store ratelimit.Store, bucket string, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := bucket + ":ip:" + c.ClientIP()
+		if userID, ok := c.Get(UserIDKey); ok {
+			key = bucket + ":user:" + fmt.Sprint(userID)
+		}
+		allowed, retryAfter, err := store.Allow(c.Request.Context(), key, limit)
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Warn("rate limit store failed", zap.String("bucket", bucket), zap.Error(err))
+			c.Next()
+			return
+		}
+		if !allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			api.AbortWithError(c, http.StatusTooManyRequests, api.ErrorResponse{
+				ErrorCode: api.ErrorCodeRateLimited,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/ratelimit"
+)
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+const testUserHeader = "X-Test-User"
+
+// newRateLimitedEngine limits /apps behind a stand-in for authentication,
+// which sets UserIDKey from a header, and leaves /healthz unlimited.
+func newRateLimitedEngine(limit ratelimit.Limit) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	store := ratelimit.NewMemoryStore(fixedClock{now: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)})
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/healthz", ok)
+	authenticate := func(c *gin.Context) {
+		if user := c.GetHeader(testUserHeader); user != "" {
+			c.Set(UserIDKey, user)
+		}
+	}
+	r.Group("/apps", authenticate, RateLimit(store, "api", limit)).GET("", ok)
+	return r
+}
+
+func get(r *gin.Engine, path string) *httptest.ResponseRecorder {
+	return getAs(r, path, "")
+}
+
+func getAs(r *gin.Engine, path, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "192.0.2.1:40000"
+	if user != "" {
+		req.Header.Set(testUserHeader, user)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitRejectsWithRetryAfter(t *testing.T) {
+	r := newRateLimitedEngine(ratelimit.Limit{Rate: 0.25, Burst: 1})
+	if w := get(r, "/apps"); w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200", w.Code)
+	}
+
+	w := get(r, "/apps")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "4" {
+		t.Errorf("Retry-After = %q, want %q", got, "4")
+	}
+	var resp api.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if resp.ErrorCode != api.ErrorCodeRateLimited {
+		t.Errorf("errorCode = %q, want %q", resp.ErrorCode, api.ErrorCodeRateLimited)
+	}
+}
+
+func TestRateLimitKeysAuthenticatedRequestsByUser(t *testing.T) {
+	r := newRateLimitedEngine(ratelimit.Limit{Rate: 0.25, Burst: 1})
+	if w := get(r, "/apps"); w.Code != http.StatusOK {
+		t.Fatalf("anonymous: status = %d, want 200", w.Code)
+	}
+	// Same IP, so only per-user buckets let these through.
+	for _, user := range []string{"1", "2"} {
+		if w := getAs(r, "/apps", user); w.Code != http.StatusOK {
+			t.Errorf("user %s: status = %d, want 200", user, w.Code)
+		}
+	}
+	if w := getAs(r, "/apps", "1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("user 1 again: status = %d, want 429", w.Code)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/logger"
+	"github.com/illa-family/builder-backend/internal/reporter"
+	"go.uber.org/zap"
+)
+
+// Recover turns handler panics into 500 responses and reports them, together
+// with any unexpected error attached to a 5xx response through c.Error.
+func Recover(r reporter.Reporter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if v := recover(); v != nil {
+				err := reporter.PanicError(v)
+				logger.FromContext(c.Request.Context()).Error("handler panicked", zap.Error(err), zap.Stack("stack"))
+				r.CaptureError(c.Request.Context(), err, ReportTags(c))
+				api.AbortWithError(c, http.StatusInternalServerError, api.ErrorResponse{
+					ErrorCode: api.ErrorCodeInternal,
+				})
+			}
+		}()
+		c.Next()
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			if last := c.Errors.Last(); last != nil {
+				reporter.Capture(c.Request.Context(), r, last.Err, ReportTags(c))
+			}
+		}
+	}
+}
+
+// ReportTags returns the request ID, user ID and app ID known for the request.
+func ReportTags(c *gin.Context) map[string]string {
+	tags := map[string]string{
+		"request_id": GetRequestID(c),
+		"route":      c.FullPath(),
+	}
+	if userID, ok := c.Get(UserIDKey); ok {
+		tags["user_id"] = fmt.Sprint(userID)
+	}
+	if appID := c.Param("appID"); appID != "" {
+		tags["app_id"] = appID
+	}
+	return tags
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/maintenance"
+)
+
+type recordingReporter struct {
+	errs []error
+}
+
+func (r *recordingReporter) CaptureError(_ context.Context, err error, _ map[string]string) {
+	r.errs = append(r.errs, err)
+}
+
+func (r *recordingReporter) Flush(time.Duration) bool {
+	return true
+}
+
+func TestRecover(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	unexpected := errors.New("database is gone")
+	tests := []struct {
+		name     string
+		handler  gin.HandlerFunc
+		status   int
+		captured bool
+	}{
+		{
+			name:     "panic",
+			handler:  func(c *gin.Context) { panic("nil map") },
+			status:   http.StatusInternalServerError,
+			captured: true,
+		},
+		{
+			name: "unexpected error on 5xx",
+			handler: func(c *gin.Context) {
+				api.AbortWithTypedError(c, unexpected)
+			},
+			status:   http.StatusInternalServerError,
+			captured: true,
+		},
+		{
+			name: "unexpected error on 2xx",
+			handler: func(c *gin.Context) {
+				_ = c.Error(unexpected)
+				c.Status(http.StatusOK)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "client error",
+			handler: func(c *gin.Context) {
+				err := &api.Error{Code: api.ErrorCodeValidationFailed, Status: http.StatusBadRequest}
+				_ = c.Error(err)
+				api.AbortWithTypedError(c, err)
+			},
+			status: http.StatusBadRequest,
+		},
+		{
+			name: "maintenance mode",
+			handler: func(c *gin.Context) {
+				err := fmt.Errorf("update app: %w", maintenance.ErrMaintenanceMode)
+				_ = c.Error(err)
+				api.AbortWithTypedError(c, err)
+			},
+			status: http.StatusServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep := &recordingReporter{}
+			r := gin.New()
+			r.Use(Recover(rep))
+			r.GET("/", tt.handler)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if captured := len(rep.errs) > 0; captured != tt.captured {
+				t.Errorf("captured %v, want captured=%v", rep.errs, tt.captured)
+			}
+		})
+	}
+}
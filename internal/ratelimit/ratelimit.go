@@ -0,0 +1,127 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket refilled at Rate tokens per second, holding at most
+// Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Store keeps the buckets. Implementations shared between replicas (e.g.
+// Redis) make all instances enforce the same counters.
+type Store interface {
+	// Allow takes one token from the bucket identified by key. When the
+	// bucket is empty it reports how long until a token is available.
+	Allow(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// refill is how long the bucket takes to fill up from empty under the
+	// limit it was last used with.
+	refill time.Duration
+}
+
+type MemoryStore struct {
+	clock Clock
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore(clock Clock) *MemoryStore {
+	return &MemoryStore{
+		clock:     clock,
+		buckets:   make(map[string]*bucket),
+		lastSweep: clock.Now(),
+	}
+}
+
+func (s *MemoryStore) Allow(_ context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	b.refill = refillTime(limit)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	if limit.Rate <= 0 {
+		return false, sweepInterval, nil
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait, nil
+}
+
+// sweep drops buckets that have refilled completely, since they are
+// indistinguishable from new ones. Each bucket is judged by its own limit,
+// as groups with different limits share the store.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if b.refill >= 0 && now.Sub(b.updated) > b.refill {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// refillTime returns how long an empty bucket takes to fill up, or -1 if it
+// never refills.
+func refillTime(limit Limit) time.Duration {
+	if limit.Rate <= 0 {
+		return -1
+	}
+	return time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)}
+	return NewMemoryStore(clock), clock
+}
+
+func allow(t *testing.T, s *MemoryStore, key string, limit Limit) (bool, time.Duration) {
+	t.Helper()
+	allowed, retryAfter, err := s.Allow(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("Allow(%q): %v", key, err)
+	}
+	return allowed, retryAfter
+}
+
+func TestBurstExhaustion(t *testing.T) {
+	s, _ := newTestStore()
+	limit := Limit{Rate: 1, Burst: 3}
+	for i := 0; i < 3; i++ {
+		if allowed, _ := allow(t, s, "k", limit); !allowed {
+			t.Fatalf("request %d was limited within the burst", i+1)
+		}
+	}
+	if allowed, _ := allow(t, s, "k", limit); allowed {
+		t.Fatal("request past the burst was allowed")
+	}
+	if allowed, _ := allow(t, s, "other", limit); !allowed {
+		t.Fatal("a different key shares the exhausted bucket")
+	}
+}
+
+func TestRefill(t *testing.T) {
+	s, clock := newTestStore()
+	limit := Limit{Rate: 2, Burst: 2}
+	allow(t, s, "k", limit)
+	allow(t, s, "k", limit)
+
+	clock.Advance(499 * time.Millisecond)
+	if allowed, _ := allow(t, s, "k", limit); allowed {
+		t.Fatal("allowed before a token was refilled")
+	}
+	clock.Advance(time.Millisecond)
+	if allowed, _ := allow(t, s, "k", limit); !allowed {
+		t.Fatal("limited after a token was refilled")
+	}
+
+	clock.Advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		if allowed, _ := allow(t, s, "k", limit); !allowed {
+			t.Fatalf("request %d was limited after a full refill", i+1)
+		}
+	}
+	if allowed, _ := allow(t, s, "k", limit); allowed {
+		t.Fatal("refill exceeded the burst")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	s, clock := newTestStore()
+	limit := Limit{Rate: 2, Burst: 1}
+	allow(t, s, "k", limit)
+
+	allowed, retryAfter := allow(t, s, "k", limit)
+	if allowed || retryAfter != 500*time.Millisecond {
+		t.Fatalf("got allowed=%v retryAfter=%v, want false 500ms", allowed, retryAfter)
+	}
+	clock.Advance(200 * time.Millisecond)
+	if _, retryAfter := allow(t, s, "k", limit); retryAfter != 300*time.Millisecond {
+		t.Fatalf("retryAfter = %v, want 300ms", retryAfter)
+	}
+}
+
+func TestSweepKeepsBucketsOfStricterLimits(t *testing.T) {
+	s, clock := newTestStore()
+	api := Limit{Rate: 20, Burst: 40}
+	auth := Limit{Rate: 0.01, Burst: 1}
+	allow(t, s, "auth:ip:192.0.2.1", auth)
+	allow(t, s, "api:ip:192.0.2.1", api)
+
+	clock.Advance(sweepInterval + time.Second)
+	allow(t, s, "api:ip:192.0.2.2", api)
+
+	if _, ok := s.buckets["api:ip:192.0.2.1"]; ok {
+		t.Error("refilled api bucket was not swept")
+	}
+	if allowed, _ := allow(t, s, "auth:ip:192.0.2.1", auth); allowed {
+		t.Error("auth bucket was swept before it refilled")
+	}
+}
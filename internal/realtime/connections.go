@@ -0,0 +1,170 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realtime
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	closeWriteTimeout = time.Second
+	// writeTimeout bounds every data write, so a stalled client can't hold
+	// its connection's writer, or a broadcast, indefinitely.
+	writeTimeout = 5 * time.Second
+	// broadcastQueueSize is how many notices may wait for delivery before
+	// Broadcast starts dropping them.
+	broadcastQueueSize = 16
+)
+
+// Connections tracks open websocket connections so they can be closed
+// cleanly on shutdown, since http.Server.Shutdown does not wait for hijacked
+// connections, and so server-initiated notices can reach every client.
+type Connections struct {
+	mu     sync.Mutex
+	conns  map[*websocket.Conn]*sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+
+	broadcasts chan []byte
+}
+
+func NewConnections() *Connections {
+	c := &Connections{
+		conns:      make(map[*websocket.Conn]*sync.Mutex),
+		broadcasts: make(chan []byte, broadcastQueueSize),
+	}
+	go c.deliverBroadcasts()
+	return c
+}
+
+// Add registers ws and reports whether it was accepted; connections are
+// refused once draining has started. Every accepted connection must be
+// released with Remove when its handler returns.
+func (c *Connections) Add(ws *websocket.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.conns[ws] = &sync.Mutex{}
+	c.wg.Add(1)
+	return true
+}
+
+func (c *Connections) Remove(ws *websocket.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.conns[ws]; !ok {
+		return
+	}
+	delete(c.conns, ws)
+	c.wg.Done()
+}
+
+// WriteMessage writes to ws, serialized with broadcasts; gorilla/websocket
+// allows only one concurrent writer per connection.
+func (c *Connections) WriteMessage(ws *websocket.Conn, messageType int, data []byte) error {
+	c.mu.Lock()
+	writeMu, ok := c.conns[ws]
+	c.mu.Unlock()
+	if !ok {
+		return websocket.ErrCloseSent
+	}
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	if err := ws.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+		return err
+	}
+	return ws.WriteMessage(messageType, data)
+}
+
+// Broadcast queues a text message for every open connection and returns
+// without waiting, as it is called on request goroutines. It reports false
+// if the message was dropped because the queue is full or draining began.
+func (c *Connections) Broadcast(data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.broadcasts <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliverBroadcasts writes queued messages in order, to all connections
+// concurrently. A connection whose write fails is closed, which ends its
+// handler.
+func (c *Connections) deliverBroadcasts() {
+	for data := range c.broadcasts {
+		c.mu.Lock()
+		conns := make([]*websocket.Conn, 0, len(c.conns))
+		for ws := range c.conns {
+			conns = append(conns, ws)
+		}
+		c.mu.Unlock()
+
+		var wg sync.WaitGroup
+		for _, ws := range conns {
+			wg.Add(1)
+			go func(ws *websocket.Conn) {
+				defer wg.Done()
+				if err := c.WriteMessage(ws, websocket.TextMessage, data); err != nil {
+					_ = ws.Close()
+				}
+			}(ws)
+		}
+		wg.Wait()
+	}
+}
+
+// Drain sends a "going away" close frame to every connection and waits until
+// their handlers have returned or ctx is done.
+func (c *Connections) Drain(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.closed {
+		close(c.broadcasts)
+	}
+	c.closed = true
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for ws := range c.conns {
+		_ = ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeWriteTimeout))
+	}
+	c.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		c.mu.Lock()
+		for ws := range c.conns {
+			_ = ws.Close()
+		}
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
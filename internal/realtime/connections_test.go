@@ -0,0 +1,115 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package realtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer accepts websocket connections into conns and keeps each
+// open until the client goes away.
+func newTestServer(t *testing.T, conns *Connections) *httptest.Server {
+	t.Helper()
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		if !conns.Add(ws) {
+			return
+		}
+		defer conns.Remove(ws)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dial(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func waitForConnections(t *testing.T, conns *Connections, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		conns.mu.Lock()
+		got := len(conns.conns)
+		conns.mu.Unlock()
+		if got == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("server did not register %d connections", n)
+}
+
+func TestBroadcastDeliversInOrder(t *testing.T) {
+	conns := NewConnections()
+	srv := newTestServer(t, conns)
+	clients := []*websocket.Conn{dial(t, srv), dial(t, srv)}
+	waitForConnections(t, conns, len(clients))
+
+	messages := []string{"first", "second", "third"}
+	for _, msg := range messages {
+		if !conns.Broadcast([]byte(msg)) {
+			t.Fatalf("Broadcast(%q) was dropped", msg)
+		}
+	}
+	for i, ws := range clients {
+		_ = ws.SetReadDeadline(time.Now().Add(time.Second))
+		for _, want := range messages {
+			_, got, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatalf("client %d: read: %v", i, err)
+			}
+			if string(got) != want {
+				t.Fatalf("client %d: got %q, want %q", i, got, want)
+			}
+		}
+	}
+}
+
+func TestBroadcastAfterDrainIsDropped(t *testing.T) {
+	conns := NewConnections()
+	if err := conns.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if conns.Broadcast([]byte("late")) {
+		t.Error("Broadcast accepted a message after draining began")
+	}
+	if err := conns.Drain(context.Background()); err != nil {
+		t.Errorf("second Drain: %v", err)
+	}
+}
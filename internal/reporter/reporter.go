@@ -0,0 +1,100 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Reporter ships unexpected errors to an external error tracker.
+// Implementations must not block the caller.
+type Reporter interface {
+	CaptureError(ctx context.Context, err error, tags map[string]string)
+	// Flush waits up to timeout for queued reports to be delivered.
+	Flush(timeout time.Duration) bool
+}
+
+// Expected is implemented by errors that are part of normal operation (not
+// found, validation, permission) and must never be reported.
+type Expected interface {
+	Expected() bool
+}
+
+var (
+	expectedMu   sync.RWMutex
+	expectedErrs []error
+)
+
+// RegisterExpected marks sentinel errors, and everything wrapping them, as
+// expected.
+func RegisterExpected(errs ...error) {
+	expectedMu.Lock()
+	defer expectedMu.Unlock()
+	expectedErrs = append(expectedErrs, errs...)
+}
+
+func IsExpected(err error) bool {
+	var e Expected
+	if errors.As(err, &e) && e.Expected() {
+		return true
+	}
+	expectedMu.RLock()
+	defer expectedMu.RUnlock()
+	for _, target := range expectedErrs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+type noopReporter struct{}
+
+func (noopReporter) CaptureError(context.Context, error, map[string]string) {}
+
+func (noopReporter) Flush(time.Duration) bool {
+	return true
+}
+
+func Noop() Reporter {
+	return noopReporter{}
+}
+
+// Capture reports err unless it is nil or expected.
+func Capture(ctx context.Context, r Reporter, err error, tags map[string]string) {
+	if err == nil || IsExpected(err) {
+		return
+	}
+	r.CaptureError(ctx, err, tags)
+}
+
+// RecoverGoroutine reports a panic in a goroutine that has no recovery
+// middleware above it, such as a websocket read loop. Use it with defer.
+func RecoverGoroutine(ctx context.Context, r Reporter, tags map[string]string) {
+	if v := recover(); v != nil {
+		r.CaptureError(ctx, PanicError(v), tags)
+	}
+}
+
+func PanicError(v interface{}) error {
+	if err, ok := v.(error); ok {
+		return fmt.Errorf("panic: %w", err)
+	}
+	return fmt.Errorf("panic: %v", v)
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// recorder is a Reporter that keeps what it was given.
+type recorder struct {
+	errs []error
+}
+
+func (r *recorder) CaptureError(_ context.Context, err error, _ map[string]string) {
+	r.errs = append(r.errs, err)
+}
+
+func (r *recorder) Flush(time.Duration) bool {
+	return true
+}
+
+type expectedErr bool
+
+func (e expectedErr) Error() string  { return "expected error" }
+func (e expectedErr) Expected() bool { return bool(e) }
+
+var errRegistered = errors.New("registered sentinel")
+
+func init() {
+	RegisterExpected(errRegistered)
+}
+
+func TestIsExpected(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"plain error", errors.New("boom"), false},
+		{"expected method", expectedErr(true), true},
+		{"expected method returning false", expectedErr(false), false},
+		{"wrapped expected method", fmt.Errorf("load: %w", expectedErr(true)), true},
+		{"registered sentinel", errRegistered, true},
+		{"wrapped registered sentinel", fmt.Errorf("load: %w", errRegistered), true},
+		{"same text as sentinel", errors.New(errRegistered.Error()), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsExpected(tt.err); got != tt.want {
+				t.Errorf("IsExpected(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaptureSkipsNilAndExpected(t *testing.T) {
+	rec := &recorder{}
+	unexpected := errors.New("boom")
+	for _, err := range []error{nil, expectedErr(true), fmt.Errorf("load: %w", errRegistered), unexpected} {
+		Capture(context.Background(), rec, err, nil)
+	}
+	if len(rec.errs) != 1 || rec.errs[0] != unexpected {
+		t.Errorf("captured %v, want only %v", rec.errs, unexpected)
+	}
+}
+
+func TestRecoverGoroutine(t *testing.T) {
+	rec := &recorder{}
+	func() {
+		defer RecoverGoroutine(context.Background(), rec, nil)
+		panic("read loop failed")
+	}()
+	if len(rec.errs) != 1 || rec.errs[0].Error() != "panic: read loop failed" {
+		t.Errorf("captured %v, want the panic", rec.errs)
+	}
+
+	rec.errs = nil
+	func() {
+		defer RecoverGoroutine(context.Background(), rec, nil)
+	}()
+	if len(rec.errs) != 0 {
+		t.Errorf("captured %v without a panic", rec.errs)
+	}
+}
+
+func TestPanicErrorWrapsErrors(t *testing.T) {
+	if err := PanicError(errRegistered); !errors.Is(err, errRegistered) {
+		t.Errorf("PanicError(%v) = %v, want it wrapped", errRegistered, err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporter
+
+import (
+	"context"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+)
+
+// sentryBufferSize bounds the events queued for delivery; events beyond it
+// are dropped so an unreachable Sentry can't back-pressure requests.
+const sentryBufferSize = 64
+
+type sentryReporter struct {
+	client *sentry.Client
+}
+
+func NewSentry(dsn, environment string) (Reporter, error) {
+	transport := sentry.NewHTTPTransport()
+	transport.BufferSize = sentryBufferSize
+	transport.Timeout = 5 * time.Second
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+		Transport:   transport,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &sentryReporter{client: client}, nil
+}
+
+func (r *sentryReporter) CaptureError(_ context.Context, err error, tags map[string]string) {
+	scope := sentry.NewScope()
+	scope.SetTags(tags)
+	r.client.CaptureException(err, &sentry.EventHint{OriginalException: err}, scope)
+}
+
+func (r *sentryReporter) Flush(timeout time.Duration) bool {
+	return r.client.Flush(timeout)
+}
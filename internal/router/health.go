@@ -0,0 +1,53 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/internal/health"
+	"github.com/illa-family/builder-backend/internal/middleware"
+)
+
+func Healthz() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": "ok",
+		})
+	}
+}
+
+func Readyz(checker *health.Checker) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		report, err := checker.SystemReadiness()
+		body := gin.H{}
+		for name, value := range checker.Info(c.Request.Context()) {
+			body[name] = value
+		}
+		body["dependencies"] = report.Dependencies
+		if err != nil {
+			dep, _ := report.FirstFailure()
+			body["status"] = "not ready"
+			body["dependency"] = dep.Name
+			body["error"] = err.Error()
+			body["requestId"] = middleware.GetRequestID(c)
+			c.JSON(http.StatusServiceUnavailable, body)
+			return
+		}
+		body["status"] = "ready"
+		c.JSON(http.StatusOK, body)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+	"github.com/illa-family/builder-backend/internal/logger"
+	"github.com/illa-family/builder-backend/internal/maintenance"
+	"go.uber.org/zap"
+)
+
+type MaintenanceRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+func GetMaintenance(sw *maintenance.Switch) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"enabled": sw.Enabled(c.Request.Context()),
+		})
+	}
+}
+
+func SetMaintenance(sw *maintenance.Switch) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var req MaintenanceRequest
+		if !api.BindJSON(c, &req) {
+			return
+		}
+		if err := sw.Set(c.Request.Context(), *req.Enabled); err != nil {
+			api.AbortWithTypedError(c, err)
+			return
+		}
+		logger.FromContext(c.Request.Context()).Info("maintenance mode changed", zap.Bool("enabled", *req.Enabled))
+		c.JSON(http.StatusOK, gin.H{
+			"enabled": *req.Enabled,
+		})
+	}
+}
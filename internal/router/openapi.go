@@ -0,0 +1,67 @@
+// Copyright 2022 The ILLA Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"mime"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illa-family/builder-backend/api"
+)
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>ILLA Builder Backend API</title>
+  <link rel="stylesheet" href="/swagger/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="/swagger/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/swagger.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>`
+
+func OpenAPISpec(spec []byte) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+	}
+}
+
+func SwaggerUI() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+	}
+}
+
+// SwaggerUIAsset serves the vendored Swagger UI files, so the page needs no
+// CDN and loads no third-party script.
+func SwaggerUIAsset() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		name := c.Param("asset")
+		data, ok := api.SwaggerUIAsset(name)
+		if !ok {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.Header("Cache-Control", "public, max-age=86400")
+		c.Data(http.StatusOK, mime.TypeByExtension(path.Ext(name)), data)
+	}
+}
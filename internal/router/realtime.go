@@ -16,28 +16,55 @@ package router
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/illa-family/builder-backend/api"
+	"github.com/gorilla/websocket"
+	"github.com/illa-family/builder-backend/internal/logger"
+	"github.com/illa-family/builder-backend/internal/metrics"
+	"github.com/illa-family/builder-backend/internal/middleware"
+	"github.com/illa-family/builder-backend/internal/realtime"
+	"github.com/illa-family/builder-backend/internal/reporter"
+	"github.com/illa-family/builder-backend/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
 )
 
-func WsPing() func(c *gin.Context) {
+func WsPing(upGrader *websocket.Upgrader, wsMetrics *metrics.WebsocketMetrics, conns *realtime.Connections, rep reporter.Reporter) func(c *gin.Context) {
 	return func(c *gin.Context) {
-		ws, err := api.UpGrader.Upgrade(c.Writer, c.Request, nil)
+		connectionID := middleware.NewID()
+		log := logger.FromContext(c.Request.Context()).With(zap.String("connection_id", connectionID))
+		ws, err := upGrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
+			log.Warn("websocket upgrade failed", zap.Error(err))
 			return
 		}
 		defer ws.Close()
+		tags := middleware.ReportTags(c)
+		tags["connection_id"] = connectionID
+		defer reporter.RecoverGoroutine(c.Request.Context(), rep, tags)
+		if !conns.Add(ws) {
+			return
+		}
+		defer conns.Remove(ws)
+		log.Info("websocket connection opened")
+		defer log.Info("websocket connection closed")
+		wsMetrics.ConnectionOpened()
+		defer wsMetrics.ConnectionClosed()
 		for {
 			mt, message, err := ws.ReadMessage()
 			if err != nil {
 				break
 			}
+			wsMetrics.MessageReceived()
+			_, span := tracing.Tracer().Start(c.Request.Context(), "realtime.ping")
+			span.SetAttributes(attribute.String("illa.connection_id", connectionID))
 			if string(message) == "ping" {
 				message = []byte("pong")
 			}
-			err = ws.WriteMessage(mt, message)
+			err = conns.WriteMessage(ws, mt, message)
+			span.End()
 			if err != nil {
 				break
 			}
+			wsMetrics.MessageSent()
 		}
 	}
 }